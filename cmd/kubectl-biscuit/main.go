@@ -0,0 +1,13 @@
+package main
+
+import (
+	"log"
+
+	"github.com/everettraven/biscuit/pkg/cmd"
+)
+
+func main() {
+	if err := cmd.NewKubectlPluginCommand().Execute(); err != nil {
+		log.Fatal(err)
+	}
+}
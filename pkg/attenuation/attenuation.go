@@ -0,0 +1,433 @@
+package attenuation
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/biscuit-auth/biscuit-go/v2/parser"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/everettraven/biscuit/pkg/tokenutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// Spec describes how to attenuate a token. Every attribute that is set
+// restricts requests to one of its values.
+type Spec struct {
+	Resources    []string `json:"resources,omitempty"`
+	Namespaces   []string `json:"namespaces,omitempty"`
+	Names        []string `json:"names,omitempty"`
+	Verbs        []string `json:"verbs,omitempty"`
+	APIGroups    []string `json:"apiGroups,omitempty"`
+	APIVersions  []string `json:"apiVersions,omitempty"`
+	Subresources []string `json:"subresources,omitempty"`
+
+	// Paths restricts non-resource requests. A trailing '*' matches any
+	// path with the given prefix. When set, resource checks only apply
+	// to resource requests.
+	Paths                []string `json:"paths,omitempty"`
+	ResourceRequestsOnly bool     `json:"resourceRequestsOnly,omitempty"`
+
+	// LabelSelectors and FieldSelectors must be matched by the selectors
+	// of list, watch and deletecollection requests, e.g. 'app=frontend'
+	// or 'spec.nodeName=node-1'. Other verbs are not restricted by them.
+	LabelSelectors []string `json:"labelSelectors,omitempty"`
+	FieldSelectors []string `json:"fieldSelectors,omitempty"`
+
+	// Impersonate lists the identities that may be impersonated, in the
+	// form KIND:NAME.
+	Impersonate []string `json:"impersonate,omitempty"`
+
+	// Audiences restricts the token to TokenReviews for one of them.
+	Audiences []string `json:"audiences,omitempty"`
+
+	// Checks are arbitrary Datalog checks, e.g.
+	// 'check if k8s:namespace($ns), $ns.starts_with("team-")'.
+	Checks []string `json:"checks,omitempty"`
+
+	// TTL and ExpiresAt are mutually exclusive.
+	TTL       *metav1.Duration `json:"ttl,omitempty"`
+	ExpiresAt *metav1.Time     `json:"expiresAt,omitempty"`
+	NotBefore *metav1.Time     `json:"notBefore,omitempty"`
+
+	// Seal prevents the attenuated token from being attenuated further.
+	Seal bool `json:"seal,omitempty"`
+}
+
+// Request is the body of a request to attenuate a token.
+type Request struct {
+	Token       string `json:"token"`
+	Attenuation Spec   `json:"attenuation"`
+}
+
+// Response is the body of the response to a Request.
+type Response struct {
+	Token string `json:"token"`
+}
+
+// Attenuate appends a block holding the checks of spec to the
+// serialized token, sealing it if requested. The attenuated token is
+// rejected if it can never be valid, i.e. if its time checks fail as
+// soon as it becomes valid.
+func Attenuate(serialized []byte, spec Spec, now time.Time) ([]byte, error) {
+	token, err := biscuit.Unmarshal(serialized)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling token: %w", err)
+	}
+
+	checks, err := spec.BlockChecks(now)
+	if err != nil {
+		return nil, err
+	}
+
+	blockBuilder := token.CreateBlock()
+	for _, check := range checks {
+		blockBuilder.AddCheck(check)
+	}
+
+	b2, err := token.Append(rand.Reader, blockBuilder.Build())
+	if err != nil {
+		return nil, fmt.Errorf("failed to append: %v", err)
+	}
+
+	validFrom := now
+	if spec.NotBefore != nil && spec.NotBefore.Time.After(now) {
+		validFrom = spec.NotBefore.Time
+	}
+
+	if err := tokenutil.CheckTime(b2, validFrom, 0); err != nil {
+		return nil, fmt.Errorf("attenuated token would never be valid: %w", err)
+	}
+
+	if spec.Seal {
+		b2, err = b2.Seal(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to seal: %v", err)
+		}
+	}
+
+	return Serialize(b2, serialized)
+}
+
+// Serialize serializes a token derived from the serialized parent,
+// carrying over the parent's root key ID, which biscuit-go drops when
+// appending or sealing.
+func Serialize(b *biscuit.Biscuit, parent []byte) ([]byte, error) {
+	token, err := b.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize biscuit: %v", err)
+	}
+
+	if keyID, ok := keys.RootKeyID(parent); ok {
+		token, err = keys.SetRootKeyID(token, keyID)
+		if err != nil {
+			return nil, fmt.Errorf("setting root key ID: %w", err)
+		}
+	}
+
+	return token, nil
+}
+
+// BlockChecks returns the checks of the block attenuating a token.
+func (s Spec) BlockChecks(now time.Time) ([]biscuit.Check, error) {
+	if s.ResourceRequestsOnly && len(s.Paths) > 0 {
+		return nil, fmt.Errorf("paths cannot be used with resource requests only")
+	}
+
+	// When non-resource paths are allowed, checks on resource attributes
+	// must not reject non-resource requests, which never carry them.
+	var nonResource string
+	if len(s.Paths) > 0 {
+		nonResource = "k8s:resource_request(false)"
+	}
+
+	checks := []biscuit.Check{}
+
+	if s.ResourceRequestsOnly {
+		check, err := parser.FromStringCheck("check if k8s:resource_request(true)")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse resource request check: %v", err)
+		}
+
+		checks = append(checks, check)
+	}
+
+	for _, attr := range []struct {
+		name      string
+		predicate string
+		values    []string
+	}{
+		{name: "resource", predicate: "k8s:resource", values: s.Resources},
+		{name: "namespace", predicate: "k8s:namespace", values: s.Namespaces},
+		{name: "name", predicate: "k8s:name", values: s.Names},
+		{name: "api group", predicate: "k8s:api_group", values: s.APIGroups},
+		{name: "api version", predicate: "k8s:api_version", values: s.APIVersions},
+		{name: "subresource", predicate: "k8s:subresource", values: s.Subresources},
+	} {
+		if len(attr.values) == 0 {
+			continue
+		}
+
+		check, err := oneOfCheck(attr.predicate, attr.values, nonResource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s check: %v", attr.name, err)
+		}
+
+		checks = append(checks, check)
+	}
+
+	if len(s.Verbs) > 0 {
+		check, err := oneOfCheck("k8s:verb", s.Verbs, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse verb check: %v", err)
+		}
+
+		checks = append(checks, check)
+	}
+
+	if len(s.Paths) > 0 {
+		queries := []string{"k8s:resource_request(true)"}
+		for _, path := range s.Paths {
+			if prefix, ok := strings.CutSuffix(path, "*"); ok {
+				queries = append(queries, fmt.Sprintf("k8s:path($path), $path.starts_with(%q)", prefix))
+				continue
+			}
+			queries = append(queries, fmt.Sprintf("k8s:path(%q)", path))
+		}
+
+		check, err := parser.FromStringCheck("check if " + strings.Join(queries, " or "))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse path check: %v", err)
+		}
+
+		checks = append(checks, check)
+	}
+
+	for _, sel := range s.LabelSelectors {
+		selectorChecks, err := labelSelectorChecks(sel)
+		if err != nil {
+			return nil, err
+		}
+
+		checks = append(checks, selectorChecks...)
+	}
+
+	for _, sel := range s.FieldSelectors {
+		selectorChecks, err := fieldSelectorChecks(sel)
+		if err != nil {
+			return nil, err
+		}
+
+		checks = append(checks, selectorChecks...)
+	}
+
+	if len(s.Impersonate) > 0 {
+		check, err := impersonateCheck(s.Impersonate)
+		if err != nil {
+			return nil, err
+		}
+
+		checks = append(checks, check)
+	}
+
+	if len(s.Audiences) > 0 {
+		check, err := tokenutil.AudienceCheck(s.Audiences)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse audience check: %v", err)
+		}
+
+		checks = append(checks, check)
+	}
+
+	for _, source := range s.Checks {
+		check, err := parseCheck(source)
+		if err != nil {
+			return nil, err
+		}
+
+		checks = append(checks, check)
+	}
+
+	validityChecks, err := s.validityChecks(now)
+	if err != nil {
+		return nil, err
+	}
+
+	checks = append(checks, validityChecks...)
+
+	return checks, nil
+}
+
+func (s Spec) validityChecks(now time.Time) ([]biscuit.Check, error) {
+	if s.TTL != nil && s.ExpiresAt != nil {
+		return nil, errors.New("ttl and expiresAt are mutually exclusive")
+	}
+
+	var expiresAt, notBefore time.Time
+	switch {
+	case s.TTL != nil:
+		if s.TTL.Duration <= 0 {
+			return nil, errors.New("ttl must be positive")
+		}
+		expiresAt = now.Add(s.TTL.Duration)
+	case s.ExpiresAt != nil:
+		expiresAt = s.ExpiresAt.Time
+	}
+
+	if s.NotBefore != nil {
+		notBefore = s.NotBefore.Time
+	}
+
+	return tokenutil.ValidityChecks(expiresAt, notBefore)
+}
+
+// parseCheck parses a Datalog check. biscuit-go's parser may panic on
+// malformed input, which is reported as an error instead.
+func parseCheck(source string) (check biscuit.Check, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			check, err = biscuit.Check{}, fmt.Errorf("parsing check %q: %v", source, r)
+		}
+	}()
+
+	check, err = parser.FromStringCheck(source)
+	if err != nil {
+		return biscuit.Check{}, fmt.Errorf("parsing check %q: %w", source, err)
+	}
+
+	return check, nil
+}
+
+// collectionVerbsQuery passes for requests other than list, watch and
+// deletecollection, the only ones carrying selectors, so that selector
+// checks leave the other verbs to the token's remaining checks.
+const collectionVerbsQuery = `k8s:verb($verb), !["list", "watch", "deletecollection"].contains($verb)`
+
+// labelSelectorChecks builds one check per requirement in the label
+// selector. Each check passes when the request's label selector
+// restricts the key at least as much as the requirement does, or when
+// the request is not for a collection.
+func labelSelectorChecks(sel string) ([]biscuit.Check, error) {
+	selector, err := labels.Parse(sel)
+	if err != nil {
+		return nil, fmt.Errorf("parsing label selector %q: %w", sel, err)
+	}
+
+	requirements, _ := selector.Requirements()
+
+	checks := []biscuit.Check{}
+	for _, req := range requirements {
+		var query string
+		switch req.Operator() {
+		case selection.Equals, selection.DoubleEquals, selection.In:
+			query = fmt.Sprintf(`k8s:label_selector(%q, $op, $values), ["=", "in"].contains($op), %s.contains($values)`, req.Key(), setLiteral(req.Values().List()))
+		case selection.NotEquals, selection.NotIn:
+			query = fmt.Sprintf(`k8s:label_selector(%q, $op, $values), ["!=", "notin"].contains($op), $values.contains(%s)`, req.Key(), setLiteral(req.Values().List()))
+		case selection.Exists:
+			query = fmt.Sprintf(`k8s:label_selector(%q, $op, $values), ["=", "in", "exists"].contains($op)`, req.Key())
+		case selection.DoesNotExist:
+			query = fmt.Sprintf(`k8s:label_selector(%q, "!", $values)`, req.Key())
+		default:
+			return nil, fmt.Errorf("label selector operator %q is not supported for attenuation", req.Operator())
+		}
+
+		check, err := parseCheck("check if " + query + " or " + collectionVerbsQuery)
+		if err != nil {
+			return nil, fmt.Errorf("parsing label selector check: %w", err)
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks, nil
+}
+
+// fieldSelectorChecks builds one check per requirement in the field
+// selector, matching requests whose field selector carries the same
+// requirement, or that are not for a collection.
+func fieldSelectorChecks(sel string) ([]biscuit.Check, error) {
+	selector, err := fields.ParseSelector(sel)
+	if err != nil {
+		return nil, fmt.Errorf("parsing field selector %q: %w", sel, err)
+	}
+
+	checks := []biscuit.Check{}
+	for _, req := range selector.Requirements() {
+		var query string
+		switch req.Operator {
+		case selection.Equals, selection.DoubleEquals:
+			query = fmt.Sprintf(`k8s:field_selector(%q, "=", $values), %s.contains($values)`, req.Field, setLiteral([]string{req.Value}))
+		case selection.NotEquals:
+			query = fmt.Sprintf(`k8s:field_selector(%q, "!=", $values), $values.contains(%s)`, req.Field, setLiteral([]string{req.Value}))
+		default:
+			return nil, fmt.Errorf("field selector operator %q is not supported for attenuation", req.Operator)
+		}
+
+		check, err := parseCheck("check if " + query + " or " + collectionVerbsQuery)
+		if err != nil {
+			return nil, fmt.Errorf("parsing field selector check: %w", err)
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks, nil
+}
+
+// impersonateCheck builds a check that passes for requests that are not
+// impersonating, or that impersonate one of identities.
+func impersonateCheck(identities []string) (biscuit.Check, error) {
+	queries := []string{`k8s:verb($verb), !($verb == "impersonate")`}
+	for _, identity := range identities {
+		kind, name, ok := strings.Cut(identity, ":")
+		if !ok {
+			return biscuit.Check{}, fmt.Errorf("invalid impersonation %q, expected KIND:NAME", identity)
+		}
+
+		switch kind {
+		case "user", "group", "serviceaccount", "uid", "userextra":
+		default:
+			return biscuit.Check{}, fmt.Errorf("invalid impersonation kind %q", kind)
+		}
+
+		queries = append(queries, fmt.Sprintf("k8s:impersonate(%q, %q)", kind, name))
+	}
+
+	check, err := parser.FromStringCheck("check if " + strings.Join(queries, " or "))
+	if err != nil {
+		return biscuit.Check{}, fmt.Errorf("failed to parse impersonate check: %v", err)
+	}
+
+	return check, nil
+}
+
+func setLiteral(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, fmt.Sprintf("%q", value))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// oneOfCheck builds a check that passes when the given single-term
+// predicate matches any of values. If or is not empty, it is added as
+// an additional query that also satisfies the check.
+func oneOfCheck(predicate string, values []string, or string) (biscuit.Check, error) {
+	var checkString strings.Builder
+	checkString.WriteString(fmt.Sprintf("check if %s(%q)", predicate, values[0]))
+	for _, value := range values[1:] {
+		checkString.WriteString(fmt.Sprintf(" or %s(%q)", predicate, value))
+	}
+
+	if or != "" {
+		checkString.WriteString(" or " + or)
+	}
+
+	return parser.FromStringCheck(checkString.String())
+}
@@ -0,0 +1,215 @@
+package attenuation
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/everettraven/biscuit/pkg/authorizer"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/everettraven/biscuit/pkg/mint"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	kauthorizer "k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+func TestSelectorChecks(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "biscuit-key.pub")
+	if err := os.WriteFile(path, public, 0o600); err != nil {
+		t.Fatalf("writing public key: %v", err)
+	}
+
+	store, err := keys.NewStore([]string{path})
+	if err != nil {
+		t.Fatalf("loading public key: %v", err)
+	}
+
+	root, err := mint.Token{Username: "jane"}.Mint(keys.PrivateKey{Key: private})
+	if err != nil {
+		t.Fatalf("minting token: %v", err)
+	}
+
+	decoded, err := base64.URLEncoding.DecodeString(root)
+	if err != nil {
+		t.Fatalf("decoding token: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		spec          Spec
+		verb          string
+		labelSelector string
+		fieldSelector string
+		wantDeny      bool
+	}{
+		{
+			name:          "same label selector",
+			spec:          Spec{LabelSelectors: []string{"app=frontend"}},
+			verb:          "list",
+			labelSelector: "app=frontend",
+		},
+		{
+			name:          "other label value",
+			spec:          Spec{LabelSelectors: []string{"app=frontend"}},
+			verb:          "list",
+			labelSelector: "app=backend",
+			wantDeny:      true,
+		},
+		{
+			name:     "no label selector",
+			spec:     Spec{LabelSelectors: []string{"app=frontend"}},
+			verb:     "watch",
+			wantDeny: true,
+		},
+		{
+			name:          "narrower label selector",
+			spec:          Spec{LabelSelectors: []string{"app=frontend"}},
+			verb:          "list",
+			labelSelector: "app=frontend,tier=web",
+		},
+		{
+			name:          "in with a narrower selector",
+			spec:          Spec{LabelSelectors: []string{"app in (frontend,backend)"}},
+			verb:          "list",
+			labelSelector: "app=frontend",
+		},
+		{
+			name:          "in with a wider selector",
+			spec:          Spec{LabelSelectors: []string{"app in (frontend,backend)"}},
+			verb:          "list",
+			labelSelector: "app in (frontend,backend,db)",
+			wantDeny:      true,
+		},
+		{
+			name:          "notin with a narrower selector",
+			spec:          Spec{LabelSelectors: []string{"app notin (db)"}},
+			verb:          "list",
+			labelSelector: "app notin (db,cache)",
+		},
+		{
+			name:          "notin with a wider selector",
+			spec:          Spec{LabelSelectors: []string{"app notin (db)"}},
+			verb:          "list",
+			labelSelector: "app notin (cache)",
+			wantDeny:      true,
+		},
+		{
+			name:          "exists with a value",
+			spec:          Spec{LabelSelectors: []string{"app"}},
+			verb:          "list",
+			labelSelector: "app=frontend",
+		},
+		{
+			name:          "exists with exists",
+			spec:          Spec{LabelSelectors: []string{"app"}},
+			verb:          "list",
+			labelSelector: "app",
+		},
+		{
+			name:          "exists with another key",
+			spec:          Spec{LabelSelectors: []string{"app"}},
+			verb:          "list",
+			labelSelector: "tier=web",
+			wantDeny:      true,
+		},
+		{
+			name:          "does not exist with does not exist",
+			spec:          Spec{LabelSelectors: []string{"!secret"}},
+			verb:          "list",
+			labelSelector: "!secret",
+		},
+		{
+			name:          "does not exist with exists",
+			spec:          Spec{LabelSelectors: []string{"!secret"}},
+			verb:          "list",
+			labelSelector: "secret",
+			wantDeny:      true,
+		},
+		{
+			name:     "deletecollection without a selector",
+			spec:     Spec{LabelSelectors: []string{"app=frontend"}},
+			verb:     "deletecollection",
+			wantDeny: true,
+		},
+		{
+			name: "get is not restricted by label selectors",
+			spec: Spec{LabelSelectors: []string{"app=frontend"}},
+			verb: "get",
+		},
+		{
+			name: "delete is not restricted by label selectors",
+			spec: Spec{LabelSelectors: []string{"app=frontend"}},
+			verb: "delete",
+		},
+		{
+			name:          "same field selector",
+			spec:          Spec{FieldSelectors: []string{"spec.nodeName=node-1"}},
+			verb:          "list",
+			fieldSelector: "spec.nodeName=node-1",
+		},
+		{
+			name:          "other field value",
+			spec:          Spec{FieldSelectors: []string{"spec.nodeName=node-1"}},
+			verb:          "list",
+			fieldSelector: "spec.nodeName=node-2",
+			wantDeny:      true,
+		},
+		{
+			name:          "not equals field selector",
+			spec:          Spec{FieldSelectors: []string{"metadata.name!=web"}},
+			verb:          "watch",
+			fieldSelector: "metadata.name!=web",
+		},
+		{
+			name: "create is not restricted by field selectors",
+			spec: Spec{FieldSelectors: []string{"spec.nodeName=node-1"}},
+			verb: "create",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attenuated, err := Attenuate(decoded, tt.spec, time.Now())
+			if err != nil {
+				t.Fatalf("attenuating token: %v", err)
+			}
+
+			attrs := kauthorizer.AttributesRecord{Verb: tt.verb, Resource: "pods", Namespace: "default", ResourceRequest: true}
+
+			if tt.labelSelector != "" {
+				selector, err := labels.Parse(tt.labelSelector)
+				if err != nil {
+					t.Fatalf("parsing label selector: %v", err)
+				}
+				attrs.LabelSelectorRequirements, _ = selector.Requirements()
+			}
+
+			if tt.fieldSelector != "" {
+				selector, err := fields.ParseSelector(tt.fieldSelector)
+				if err != nil {
+					t.Fatalf("parsing field selector: %v", err)
+				}
+				attrs.FieldSelectorRequirements = selector.Requirements()
+			}
+
+			decision, reason, err := authorizer.NewBiscuit(store, nil).EvaluateToken(context.Background(), base64.URLEncoding.EncodeToString(attenuated), attrs)
+			if err != nil {
+				t.Fatalf("evaluating token: %v", err)
+			}
+
+			if denied := decision == kauthorizer.DecisionDeny; denied != tt.wantDeny {
+				t.Errorf("got decision %v (%q), want denied %v", decision, reason, tt.wantDeny)
+			}
+		})
+	}
+}
@@ -2,72 +2,249 @@ package authenticator
 
 import (
 	"context"
-	"crypto/ed25519"
-	"encoding/base64"
+	"errors"
 	"fmt"
-	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/biscuit-auth/biscuit-go/v2"
 	"github.com/biscuit-auth/biscuit-go/v2/parser"
+	"github.com/everettraven/biscuit/pkg/identitypolicy"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/everettraven/biscuit/pkg/mint"
+	"github.com/everettraven/biscuit/pkg/revocation"
+	"github.com/everettraven/biscuit/pkg/tokencache"
+	"github.com/everettraven/biscuit/pkg/tokenutil"
 	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
 )
 
-func NewBiscuit(pubKeyFile string) *Biscuit {
-	return &Biscuit{
-		pubKeyFile: pubKeyFile,
+// NewBiscuit returns an authenticator verifying biscuit tokens with the
+// public keys and storing them in cache for the authorizer. Tokens are
+// rejected if cache is nil.
+func NewBiscuit(publicKeys *keys.Store, cache *tokencache.Cache, opts ...Option) *Biscuit {
+	b := &Biscuit{
+		publicKeys: publicKeys,
+		cache:      cache,
+		now:        time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+type Option func(*Biscuit)
+
+// WithClockSkew sets the clock skew tolerated when evaluating the
+// expiry and not-before checks of a token.
+func WithClockSkew(skew time.Duration) Option {
+	return func(b *Biscuit) {
+		b.clockSkew = skew
+	}
+}
+
+// WithLimits sets the limits on the size of tokens and on the resources
+// spent evaluating them.
+func WithLimits(limits tokenutil.Limits) Option {
+	return func(b *Biscuit) {
+		b.limits = limits
+	}
+}
+
+// WithRevocationList rejects tokens revoked by the list.
+func WithRevocationList(list *revocation.List) Option {
+	return func(b *Biscuit) {
+		b.revocations = list
+	}
+}
+
+// WithImplicitAudiences sets the audiences tokens are authenticated for
+// when the TokenReview does not specify any.
+func WithImplicitAudiences(audiences []string) Option {
+	return func(b *Biscuit) {
+		b.implicitAudiences = audiences
+	}
+}
+
+// WithIdentityPolicy rejects tokens carrying a username or group that
+// the identity policy does not allow for the key that signed them.
+func WithIdentityPolicy(policy *identitypolicy.File) Option {
+	return func(b *Biscuit) {
+		b.identityPolicy = policy
+	}
+}
+
+// WithPrefixes prepends the prefixes to the username and groups of
+// authenticated identities. The authorizer must be configured with the
+// same prefixes.
+func WithPrefixes(prefixes identitypolicy.Prefixes) Option {
+	return func(b *Biscuit) {
+		b.prefixes = prefixes
+	}
+}
+
+// WithRequireSealed rejects tokens that are not sealed when they
+// identify one of users or a member of one of groups, so that they
+// cannot be attenuated and handed on.
+func WithRequireSealed(users, groups []string) Option {
+	return func(b *Biscuit) {
+		b.sealedUsers = users
+		b.sealedGroups = groups
 	}
 }
 
 type Biscuit struct {
-	pubKeyFile string
+	publicKeys *keys.Store
+	cache      *tokencache.Cache
+	clockSkew  time.Duration
+	limits     tokenutil.Limits
+	now        func() time.Time
+
+	revocations       *revocation.List
+	implicitAudiences []string
+	identityPolicy    *identitypolicy.File
+	prefixes          identitypolicy.Prefixes
+
+	sealedUsers  []string
+	sealedGroups []string
 }
 
 func (b *Biscuit) AuthenticateToken(ctx context.Context, token string) (*authenticator.Response, bool, error) {
-	decodedToken, err := base64.URLEncoding.DecodeString(token)
+	biscToken, err := b.limits.Decode(token)
 	if err != nil {
-		return nil, false, fmt.Errorf("decoding token: %w", err)
+		return nil, false, err
 	}
 
-	biscToken, err := biscuit.Unmarshal(decodedToken)
+	key, authz, err := b.publicKeys.Current().VerifiedAuthorizer(biscToken, b.now(), b.limits.AuthorizerOptions()...)
 	if err != nil {
-		return nil, false, fmt.Errorf("unmarshalling token: %w", err)
+		return nil, false, fmt.Errorf("validating biscuit token: %w", err)
+	}
+
+	if b.revocations != nil {
+		if err := b.revocations.Check(biscToken); err != nil {
+			return nil, false, err
+		}
 	}
 
-	publicKeyBytes, err := os.ReadFile(b.pubKeyFile)
+	now := b.now()
+
+	err = tokenutil.CheckTime(biscToken, now, b.clockSkew)
 	if err != nil {
-		return nil, false, fmt.Errorf("reading public key file: %w", err)
+		return nil, false, fmt.Errorf("token is expired or not yet valid: %w", err)
 	}
 
-	publicRoot := ed25519.PublicKey(publicKeyBytes)
+	audiences, ok := authenticator.AudiencesFrom(ctx)
+	if !ok {
+		audiences = b.implicitAudiences
+	}
 
-	authz, err := biscToken.Authorizer(publicRoot)
+	audiences, err = tokenutil.CheckAudiences(biscToken, audiences)
 	if err != nil {
-		return nil, false, fmt.Errorf("validating biscuit token: %w", err)
+		return nil, false, err
+	}
+
+	for _, fact := range tokenutil.TimeFacts(now, b.clockSkew) {
+		authz.AddFact(fact)
+	}
+
+	for _, fact := range tokenutil.AudienceFacts(audiences) {
+		authz.AddFact(fact)
+	}
+
+	identity, err := TokenIdentity(authz)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if b.identityPolicy != nil {
+		if err := b.identityPolicy.Current().Check(key.ID, key.HasID, identity.GetName(), identity.GetGroups()); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if b.requiresSeal(identity.GetName(), identity.GetGroups()) && !tokenutil.Sealed(biscToken) {
+		return nil, false, fmt.Errorf("user %q must authenticate with a sealed token", identity.GetName())
+	}
+
+	// Without the digest the authorizer would have no opinion on the
+	// user's requests, leaving the token's checks unenforced.
+	if b.cache == nil {
+		return nil, false, errors.New("biscuit tokens cannot be authenticated without a token cache")
+	}
+
+	identity.GetExtra()[tokencache.ExtraKey] = []string{b.cache.Put(token, biscToken, identity, audiences)}
+
+	return &authenticator.Response{
+		User:      b.prefixes.Apply(identity),
+		Audiences: audiences,
+	}, true, nil
+}
+
+// TokenIdentity returns the identity carried by the authority block of
+// the token verified by authz, before any prefixes are applied. Facts
+// the token's checks depend on, such as the time, should be added to
+// authz beforehand.
+func TokenIdentity(authz biscuit.Authorizer) (user.Info, error) {
+	policy, err := parser.FromStringPolicy("allow if true")
+	if err != nil {
+		return nil, fmt.Errorf("parsing policy: %w", err)
+	}
+
+	authz.AddPolicy(policy)
+
+	// Authorize loads the authority block into the authorizer so that the
+	// identity facts can be queried. Checks that depend on request
+	// attributes are expected to fail here and are enforced by the
+	// authorizer instead, so only limit violations are reported.
+	err = tokenutil.WrapLimitError(authz.Authorize())
+	if errors.Is(err, tokenutil.ErrLimitExceeded) {
+		return nil, err
 	}
 
 	username, err := usernameFromAuthorizer(authz)
 	if err != nil {
-		return nil, false, fmt.Errorf("extracting username from token: %w", err)
+		return nil, fmt.Errorf("extracting username from token: %w", tokenutil.WrapLimitError(err))
+	}
+
+	uid, err := uidFromAuthorizer(authz)
+	if err != nil {
+		return nil, fmt.Errorf("extracting UID from token: %w", tokenutil.WrapLimitError(err))
 	}
 
 	groups, err := groupsFromAuthorizer(authz)
 	if err != nil {
-		return nil, false, fmt.Errorf("extracting groups from token: %w", err)
+		return nil, fmt.Errorf("extracting groups from token: %w", tokenutil.WrapLimitError(err))
+	}
+
+	extra, err := extraFromAuthorizer(authz, username)
+	if err != nil {
+		return nil, fmt.Errorf("extracting extra from token: %w", tokenutil.WrapLimitError(err))
 	}
 
-	user := &userInfo{
+	return &userInfo{
 		username: username,
+		uid:      uid,
 		groups:   groups,
-		extra: map[string][]string{
-			// TODO: probably not all that secure?
-			"everettraven.github.io/biscuit": {token},
-		},
+		extra:    extra,
+	}, nil
+}
+
+func (b *Biscuit) requiresSeal(username string, groups []string) bool {
+	if slices.Contains(b.sealedUsers, username) {
+		return true
 	}
 
-	return &authenticator.Response{
-		User: user,
-	}, true, nil
+	for _, group := range groups {
+		if slices.Contains(b.sealedGroups, group) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func usernameFromAuthorizer(authorizer biscuit.Authorizer) (string, error) {
@@ -95,6 +272,46 @@ func usernameFromAuthorizer(authorizer biscuit.Authorizer) (string, error) {
 	return "", fmt.Errorf("no username found")
 }
 
+// uidFromAuthorizer returns the UID from the k8s:userinfo:uid fact, or
+// an empty UID if the token has none.
+func uidFromAuthorizer(authorizer biscuit.Authorizer) (string, error) {
+	rule, err := parser.FromStringRule(`
+		uid($uid) <- k8s:userinfo:uid($uid)
+	`)
+	if err != nil {
+		return "", fmt.Errorf("creating query rule: %w", err)
+	}
+
+	facts, err := authorizer.Query(rule)
+	if err != nil {
+		return "", fmt.Errorf("querying facts: %w", err)
+	}
+
+	uids := []string{}
+
+	for _, fact := range facts {
+		if fact.Name != "uid" {
+			continue
+		}
+
+		uid, ok := fact.IDs[0].(biscuit.String)
+		if !ok {
+			return "", fmt.Errorf("uid should be a string")
+		}
+		uids = append(uids, string(uid))
+	}
+
+	if len(uids) > 1 {
+		return "", fmt.Errorf("token should only have one uid")
+	}
+
+	if len(uids) == 0 {
+		return "", nil
+	}
+
+	return uids[0], nil
+}
+
 func groupsFromAuthorizer(authorizer biscuit.Authorizer) ([]string, error) {
 	rule, err := parser.FromStringRule(`
 		group($name) <- k8s:userinfo:group($name)
@@ -122,6 +339,50 @@ func groupsFromAuthorizer(authorizer biscuit.Authorizer) ([]string, error) {
 	return groups, nil
 }
 
+// extraFromAuthorizer returns the user's extra attributes from the
+// k8s:userinfo:extra(key, value) facts. Facts using keys reserved by
+// Kubernetes or the webhook are ignored, except for the pod binding of
+// ServiceAccounts, see mint.IsBoundExtraKey.
+func extraFromAuthorizer(authorizer biscuit.Authorizer, username string) (map[string][]string, error) {
+	rule, err := parser.FromStringRule(`
+		extra($key, $value) <- k8s:userinfo:extra($key, $value)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("creating query rule: %w", err)
+	}
+
+	facts, err := authorizer.Query(rule)
+	if err != nil {
+		return nil, fmt.Errorf("querying facts: %w", err)
+	}
+
+	extra := map[string][]string{}
+
+	for _, fact := range facts {
+		if fact.Name != "extra" {
+			continue
+		}
+
+		if len(fact.IDs) != 2 {
+			return nil, fmt.Errorf("extra should have two terms")
+		}
+
+		key, keyOK := fact.IDs[0].(biscuit.String)
+		value, valueOK := fact.IDs[1].(biscuit.String)
+		if !keyOK || !valueOK {
+			return nil, fmt.Errorf("extra terms should be strings")
+		}
+
+		if mint.IsReservedExtraKey(string(key)) && !mint.IsBoundExtraKey(username, string(key)) {
+			continue
+		}
+
+		extra[string(key)] = append(extra[string(key)], string(value))
+	}
+
+	return extra, nil
+}
+
 type userInfo struct {
 	username string
 	groups   []string
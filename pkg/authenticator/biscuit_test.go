@@ -0,0 +1,75 @@
+package authenticator
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/biscuit-auth/biscuit-go/v2/parser"
+)
+
+func TestTokenIdentityReservedExtra(t *testing.T) {
+	tests := []struct {
+		username string
+		wantKeys []string
+	}{
+		{
+			username: "jane",
+			wantKeys: []string{"team"},
+		},
+		{
+			username: "system:serviceaccount:ci:builder",
+			wantKeys: []string{"authentication.kubernetes.io/pod-name", "team"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			public, private, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatalf("generating key: %v", err)
+			}
+
+			// Tokens minted by this repository cannot carry reserved keys,
+			// so build one by hand as any other key holder could.
+			authority, err := parser.FromStringBlock(fmt.Sprintf(`
+				k8s:userinfo:username(%q);
+				k8s:userinfo:extra("team", "payments");
+				k8s:userinfo:extra("everettraven.github.io/biscuit-token-digest", "forged");
+				k8s:userinfo:extra("everettraven.github.io/biscuit", "legacy");
+				k8s:userinfo:extra("authentication.kubernetes.io/pod-name", "builder-7d9f");
+			`, tt.username))
+			if err != nil {
+				t.Fatalf("parsing authority block: %v", err)
+			}
+
+			builder := biscuit.NewBuilder(private)
+			if err := builder.AddBlock(authority); err != nil {
+				t.Fatalf("adding authority block: %v", err)
+			}
+
+			token, err := builder.Build()
+			if err != nil {
+				t.Fatalf("building token: %v", err)
+			}
+
+			authz, err := token.Authorizer(public)
+			if err != nil {
+				t.Fatalf("verifying token: %v", err)
+			}
+
+			identity, err := TokenIdentity(authz)
+			if err != nil {
+				t.Fatalf("reading identity: %v", err)
+			}
+
+			if keys := slices.Sorted(maps.Keys(identity.GetExtra())); !slices.Equal(keys, tt.wantKeys) {
+				t.Errorf("got extra keys %q, want %q", keys, tt.wantKeys)
+			}
+		})
+	}
+}
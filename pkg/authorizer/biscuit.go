@@ -2,89 +2,298 @@ package authorizer
 
 import (
 	"context"
-	"crypto/ed25519"
-	"encoding/base64"
+	"errors"
 	"fmt"
-	"os"
-	"strings"
+	"log"
+	"time"
 
 	"github.com/biscuit-auth/biscuit-go/v2"
 	"github.com/biscuit-auth/biscuit-go/v2/parser"
+	"github.com/everettraven/biscuit/pkg/identitypolicy"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/everettraven/biscuit/pkg/revocation"
+	"github.com/everettraven/biscuit/pkg/tokencache"
+	"github.com/everettraven/biscuit/pkg/tokenutil"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
 )
 
-func NewBiscuit(publicKeyFile string) *Biscuit {
-	return &Biscuit{
-		pubKeyFile: publicKeyFile,
+// NewBiscuit returns an authorizer evaluating the tokens that the
+// authenticator stored in cache. The cache may be nil when only
+// EvaluateToken is used.
+func NewBiscuit(publicKeys *keys.Store, cache *tokencache.Cache, opts ...Option) *Biscuit {
+	b := &Biscuit{
+		publicKeys: publicKeys,
+		cache:      cache,
+		now:        time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+type Option func(*Biscuit)
+
+// WithClockSkew sets the clock skew tolerated when evaluating the
+// expiry and not-before checks of a token.
+func WithClockSkew(skew time.Duration) Option {
+	return func(b *Biscuit) {
+		b.clockSkew = skew
+	}
+}
+
+// WithGrantMode enables grant mode, in which the authority block of a
+// token may carry k8s:grant(api_group, resource, subresource, verb,
+// namespace) facts. A request matching a grant, with all of the token's
+// checks passing, is allowed rather than left to the other authorizers.
+// "*" matches any value, an API group of "" matches the core group, a
+// subresource of "" matches the main resource only and a namespace of ""
+// matches cluster-scoped requests.
+func WithGrantMode(enabled bool) Option {
+	return func(b *Biscuit) {
+		b.grantMode = enabled
+	}
+}
+
+// WithPolicyFile adds the operator policy to every token evaluation.
+// Its policies are evaluated in order before the built-in policy, so a
+// matching deny policy denies the request, and in grant mode a matching
+// allow policy allows it.
+func WithPolicyFile(policy *PolicyFile) Option {
+	return func(b *Biscuit) {
+		b.policy = policy
+	}
+}
+
+// grantPolicy allows requests matching a k8s:grant fact. Only facts from
+// the authority block and the authorizer are visible to policies, so
+// attenuation blocks cannot add grants of their own.
+const grantPolicy = `allow if k8s:grant($group, $resource, $subresource, $verb, $namespace), k8s:api_group($g), k8s:resource($r), k8s:subresource($sr), k8s:verb($v), k8s:namespace($ns), $group == "*" || $group == $g, $resource == "*" || $resource == $r, $subresource == "*" || $subresource == $sr, $verb == "*" || $verb == $v, $namespace == "*" || $namespace == $ns`
+
+// WithImpersonationCarryThrough enables carrying the checks of a token
+// through to the requests of the identities its holder impersonates.
+// When the holder impersonates the token digest user extra with the
+// digest of their own token, which must be allowed like any other
+// request, requests carrying a digest for a different identity are
+// evaluated against the token's checks rather than denied. Carried
+// tokens only ever restrict, so in grant mode their grants are ignored.
+func WithImpersonationCarryThrough(enabled bool) Option {
+	return func(b *Biscuit) {
+		b.carryThrough = enabled
+	}
+}
+
+// WithPrefixes sets the prefixes the authenticator prepends to the
+// username and groups of identities, which are stripped from requesting
+// users before matching them against the identity of their token.
+func WithPrefixes(prefixes identitypolicy.Prefixes) Option {
+	return func(b *Biscuit) {
+		b.prefixes = prefixes
+	}
+}
+
+// WithRevocationList denies requests made with tokens revoked by the
+// list. Authentication results are cached by the API server, so this
+// also cuts off tokens revoked after they were authenticated.
+func WithRevocationList(list *revocation.List) Option {
+	return func(b *Biscuit) {
+		b.revocations = list
+	}
+}
+
+// WithLimits sets the limits on the size of tokens and on the resources
+// spent evaluating them.
+func WithLimits(limits tokenutil.Limits) Option {
+	return func(b *Biscuit) {
+		b.limits = limits
 	}
 }
 
 type Biscuit struct {
-	pubKeyFile string
+	publicKeys *keys.Store
+	cache      *tokencache.Cache
+	clockSkew  time.Duration
+	limits     tokenutil.Limits
+	grantMode  bool
+	policy     *PolicyFile
+	now        func() time.Time
+
+	carryThrough bool
+	revocations  *revocation.List
+	prefixes     identitypolicy.Prefixes
 }
 
 func (b *Biscuit) Authorize(ctx context.Context, attrs authorizer.Attributes) (authorizer.Decision, string, error) {
+	r := b.resolve(attrs)
+	if !r.evaluate {
+		if r.decision == authorizer.DecisionDeny {
+			log.Printf("denying request from %q, %s\n", attrs.GetUser().GetName(), r.reason)
+		}
+		return r.decision, r.reason, nil
+	}
+
+	return b.evaluate(authenticator.WithAudiences(ctx, r.audiences), r.token, attrs, r.grant)
+}
+
+// resolution is the token a request is evaluated against or, if the
+// decision does not depend on evaluating a token, the decision.
+type resolution struct {
+	evaluate  bool
+	token     string
+	grant     bool
+	audiences []string
+
+	decision authorizer.Decision
+	reason   string
+}
+
+func (b *Biscuit) resolve(attrs authorizer.Attributes) resolution {
 	extras := attrs.GetUser().GetExtra()
-	token, ok := extras["everettraven.github.io/biscuit"]
-	if !ok {
-		return authorizer.DecisionNoOpinion, "", nil
+	digest, ok := extras[tokencache.ExtraKey]
+	if !ok || len(digest) == 0 {
+		return resolution{decision: authorizer.DecisionNoOpinion}
+	}
+
+	// The user was authenticated with a biscuit token, so leaving the
+	// decision to the other authorizers would skip its checks. Deny when
+	// the token is unknown to this webhook, e.g. after a restart or when
+	// authenticated by another replica.
+	var entry tokencache.Entry
+	if b.cache != nil {
+		entry, ok = b.cache.Get(digest[0])
+	}
+
+	if !ok || b.cache == nil {
+		return resolution{
+			decision: authorizer.DecisionDeny,
+			reason:   "biscuit token is not known to this webhook, authenticate again",
+		}
+	}
+
+	// The extra can be set by anyone allowed to impersonate, so only
+	// evaluate the token for the identity it authenticated, once the
+	// prefixes are stripped, unless its checks are being carried through
+	// an impersonation.
+	requester, err := b.prefixes.Strip(attrs.GetUser())
+	if err == nil {
+		err = matchIdentity(entry.User, requester)
 	}
 
-	decodedToken, err := base64.URLEncoding.DecodeString(token[0])
 	if err != nil {
-		return authorizer.DecisionNoOpinion, "", fmt.Errorf("decoding token: %w", err)
+		if b.carryThrough {
+			return resolution{evaluate: true, token: entry.Token, grant: false, audiences: entry.Audiences}
+		}
+
+		return resolution{
+			decision: authorizer.DecisionDeny,
+			reason:   fmt.Sprintf("biscuit token does not belong to the requesting user: %v", err),
+		}
 	}
 
-	biscToken, err := biscuit.Unmarshal(decodedToken)
+	// Impersonating the token digest user extra, which carrying the checks
+	// through requires, is evaluated like any other request, so it must
+	// pass the token's checks and be allowed by RBAC or a grant.
+	return resolution{evaluate: true, token: entry.Token, grant: b.grantMode, audiences: entry.Audiences}
+}
+
+// EvaluateToken evaluates the base64 encoded token against the request
+// attributes, for the audiences set on ctx with
+// authenticator.WithAudiences. Requests failing any of the token's
+// checks are denied. In grant mode, requests matching a grant are
+// allowed; otherwise there is no opinion.
+func (b *Biscuit) EvaluateToken(ctx context.Context, token string, attrs authorizer.Attributes) (authorizer.Decision, string, error) {
+	return b.evaluate(ctx, token, attrs, b.grantMode)
+}
+
+// evaluate evaluates the token, allowing requests matching a grant only
+// if grant is set.
+func (b *Biscuit) evaluate(ctx context.Context, token string, attrs authorizer.Attributes, grant bool) (authorizer.Decision, string, error) {
+	biscToken, err := b.limits.Decode(token)
 	if err != nil {
-		return authorizer.DecisionNoOpinion, "", fmt.Errorf("unmarshalling token: %w", err)
+		return authorizer.DecisionNoOpinion, "", err
 	}
 
-	publicKeyBytes, err := os.ReadFile(b.pubKeyFile)
+	if b.revocations != nil {
+		if err := b.revocations.Check(biscToken); err != nil {
+			return authorizer.DecisionDeny, err.Error(), nil
+		}
+	}
+
+	audiences, _ := authenticator.AudiencesFrom(ctx)
+
+	authz, _, err := b.newAuthorizer(biscToken, attrs, grant, audiences)
 	if err != nil {
-		return authorizer.DecisionNoOpinion, "", fmt.Errorf("reading public key file: %w", err)
+		return authorizer.DecisionNoOpinion, "", err
 	}
 
-	publicRoot := ed25519.PublicKey(publicKeyBytes)
+	return decide(tokenutil.WrapLimitError(authz.Authorize()), grant)
+}
 
-	var blockString strings.Builder
+// newAuthorizer returns an authorizer for the token loaded with the
+// request facts, the facts of the audiences the token was authenticated
+// for and the policies, which it also returns in evaluation order.
+func (b *Biscuit) newAuthorizer(biscToken *biscuit.Biscuit, attrs authorizer.Attributes, grant bool, audiences []string) (biscuit.Authorizer, []biscuit.Policy, error) {
+	authz, err := b.publicKeys.Current().Authorizer(biscToken, b.now(), b.limits.AuthorizerOptions()...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("validating biscuit token: %w", err)
+	}
 
-	if attrs.GetResource() != "" {
-		blockString.WriteString(fmt.Sprintf("k8s:resource(%q);\n", attrs.GetResource()))
+	for _, fact := range RequestFacts(attrs) {
+		authz.AddFact(fact)
 	}
 
-	if attrs.GetNamespace() != "" {
-		blockString.WriteString(fmt.Sprintf("k8s:namespace(%q);\n", attrs.GetNamespace()))
+	for _, fact := range tokenutil.TimeFacts(b.now(), b.clockSkew) {
+		authz.AddFact(fact)
 	}
 
-	if attrs.GetName() != "" {
-		blockString.WriteString(fmt.Sprintf("k8s:name(%q);\n", attrs.GetName()))
+	for _, fact := range tokenutil.AudienceFacts(audiences) {
+		authz.AddFact(fact)
 	}
 
-	if attrs.GetVerb() != "" {
-		blockString.WriteString(fmt.Sprintf("k8s:verb(%q);\n", attrs.GetVerb()))
+	policies := []biscuit.Policy{}
+
+	if b.policy != nil {
+		operatorPolicy := b.policy.Current()
+		authz.AddBlock(operatorPolicy.Block)
+		policies = append(policies, operatorPolicy.Policies...)
 	}
 
-	blockString.WriteString("allow if true;\n")
+	policyString := "allow if true"
+	if grant {
+		policyString = grantPolicy
+	}
 
-	authz, err := biscToken.Authorizer(publicRoot)
+	policy, err := parser.FromStringPolicy(policyString)
 	if err != nil {
-		return authorizer.DecisionNoOpinion, "", fmt.Errorf("validating biscuit token: %w", err)
+		return nil, nil, fmt.Errorf("parsing policy: %w", err)
 	}
 
-	parsedAuthorizer, err := parser.FromStringAuthorizer(blockString.String())
-	if err != nil {
-		panic(fmt.Errorf("failed to parse authorizer: %v", err))
+	policies = append(policies, policy)
+
+	for _, policy := range policies {
+		authz.AddPolicy(policy)
 	}
 
-	authz.AddAuthorizer(parsedAuthorizer)
+	return authz, policies, nil
+}
 
-	err = authz.Authorize()
-	if err != nil {
+// decide maps the result of authorizing a token to a decision.
+func decide(err error, grant bool) (authorizer.Decision, string, error) {
+	switch {
+	case err == nil && grant:
+		return authorizer.DecisionAllow, "granted by biscuit token", nil
+	case err == nil:
+		return authorizer.DecisionNoOpinion, "", nil
+	case errors.Is(err, biscuit.ErrNoMatchingPolicy):
+		return authorizer.DecisionNoOpinion, "", nil
+	case errors.Is(err, tokenutil.ErrLimitExceeded):
+		return authorizer.DecisionDeny, "biscuit token exceeds evaluation limits", err
+	default:
 		return authorizer.DecisionDeny, err.Error(), nil
 	}
-
-	return authorizer.DecisionNoOpinion, "", nil
 }
 
 func usernameFromAuthorizer(authorizer biscuit.Authorizer) (string, error) {
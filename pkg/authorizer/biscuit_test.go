@@ -0,0 +1,287 @@
+package authorizer
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/everettraven/biscuit/pkg/attenuation"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/everettraven/biscuit/pkg/mint"
+	"github.com/everettraven/biscuit/pkg/revocation"
+	"github.com/everettraven/biscuit/pkg/tokencache"
+	"github.com/everettraven/biscuit/pkg/tokenutil"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// newTestKeys returns a private key and a store trusting its public key.
+func newTestKeys(t *testing.T) (keys.PrivateKey, *keys.Store) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "biscuit-key.pub")
+	if err := os.WriteFile(path, public, 0o600); err != nil {
+		t.Fatalf("writing public key: %v", err)
+	}
+
+	store, err := keys.NewStore([]string{path})
+	if err != nil {
+		t.Fatalf("loading public key: %v", err)
+	}
+
+	return keys.PrivateKey{Key: private}, store
+}
+
+func mintTestToken(t *testing.T, key keys.PrivateKey, token mint.Token) string {
+	t.Helper()
+
+	minted, err := token.Mint(key)
+	if err != nil {
+		t.Fatalf("minting token: %v", err)
+	}
+
+	return minted
+}
+
+// attenuateTestToken attenuates the base64 encoded token with spec.
+func attenuateTestToken(t *testing.T, token string, spec attenuation.Spec) string {
+	t.Helper()
+
+	decoded, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		t.Fatalf("decoding token: %v", err)
+	}
+
+	attenuated, err := attenuation.Attenuate(decoded, spec, time.Now())
+	if err != nil {
+		t.Fatalf("attenuating token: %v", err)
+	}
+
+	return base64.URLEncoding.EncodeToString(attenuated)
+}
+
+// cacheTestToken stores the token in cache as the authenticator does,
+// returning the identity it authenticated with the digest extra set.
+func cacheTestToken(t *testing.T, cache *tokencache.Cache, token string, identity *user.DefaultInfo) *user.DefaultInfo {
+	t.Helper()
+
+	b, err := tokenutil.Limits{}.Decode(token)
+	if err != nil {
+		t.Fatalf("decoding token: %v", err)
+	}
+
+	digest := cache.Put(token, b, identity, nil)
+
+	authenticated := *identity
+	authenticated.Groups = append(append([]string{}, identity.Groups...), user.AllAuthenticated)
+	authenticated.Extra = map[string][]string{tokencache.ExtraKey: {digest}}
+
+	return &authenticated
+}
+
+func TestGrantMode(t *testing.T) {
+	key, store := newTestKeys(t)
+
+	tests := []struct {
+		name     string
+		grants   []string
+		attrs    authorizer.AttributesRecord
+		decision authorizer.Decision
+	}{
+		{
+			name:     "grant matches the main resource",
+			grants:   []string{"pods:get"},
+			attrs:    authorizer.AttributesRecord{Verb: "get", Resource: "pods", Namespace: "default", ResourceRequest: true},
+			decision: authorizer.DecisionAllow,
+		},
+		{
+			name:     "grant without subresource does not match a subresource",
+			grants:   []string{"pods:get:*"},
+			attrs:    authorizer.AttributesRecord{Verb: "get", Resource: "pods", Subresource: "exec", Namespace: "kube-system", ResourceRequest: true},
+			decision: authorizer.DecisionNoOpinion,
+		},
+		{
+			name:     "grant with subresource matches it",
+			grants:   []string{"pods/log:get"},
+			attrs:    authorizer.AttributesRecord{Verb: "get", Resource: "pods", Subresource: "log", Namespace: "default", ResourceRequest: true},
+			decision: authorizer.DecisionAllow,
+		},
+		{
+			name:     "grant with subresource does not match another one",
+			grants:   []string{"pods/log:get"},
+			attrs:    authorizer.AttributesRecord{Verb: "get", Resource: "pods", Subresource: "exec", Namespace: "default", ResourceRequest: true},
+			decision: authorizer.DecisionNoOpinion,
+		},
+		{
+			name:     "grant with subresource does not match the main resource",
+			grants:   []string{"pods/log:get"},
+			attrs:    authorizer.AttributesRecord{Verb: "get", Resource: "pods", Namespace: "default", ResourceRequest: true},
+			decision: authorizer.DecisionNoOpinion,
+		},
+		{
+			name:     "core grant does not match another group",
+			grants:   []string{"pods:get:*"},
+			attrs:    authorizer.AttributesRecord{Verb: "get", APIGroup: "metrics.k8s.io", Resource: "pods", Namespace: "default", ResourceRequest: true},
+			decision: authorizer.DecisionNoOpinion,
+		},
+		{
+			name:     "core grant does not match a lookalike group",
+			grants:   []string{"secrets:get:default"},
+			attrs:    authorizer.AttributesRecord{Verb: "get", APIGroup: "evil.example.com", Resource: "secrets", Namespace: "default", ResourceRequest: true},
+			decision: authorizer.DecisionNoOpinion,
+		},
+		{
+			name:     "grant with group matches it",
+			grants:   []string{"deployments.apps:list:one"},
+			attrs:    authorizer.AttributesRecord{Verb: "list", APIGroup: "apps", Resource: "deployments", Namespace: "one", ResourceRequest: true},
+			decision: authorizer.DecisionAllow,
+		},
+		{
+			name:     "grant with group does not match the core group",
+			grants:   []string{"deployments.apps:list:one"},
+			attrs:    authorizer.AttributesRecord{Verb: "list", Resource: "deployments", Namespace: "one", ResourceRequest: true},
+			decision: authorizer.DecisionNoOpinion,
+		},
+		{
+			name:     "wildcard group and subresource match anything",
+			grants:   []string{"pods.*/*:get"},
+			attrs:    authorizer.AttributesRecord{Verb: "get", APIGroup: "metrics.k8s.io", Resource: "pods", Subresource: "status", Namespace: "default", ResourceRequest: true},
+			decision: authorizer.DecisionAllow,
+		},
+		{
+			name:     "grant does not match another namespace",
+			grants:   []string{"pods:get:one"},
+			attrs:    authorizer.AttributesRecord{Verb: "get", Resource: "pods", Namespace: "two", ResourceRequest: true},
+			decision: authorizer.DecisionNoOpinion,
+		},
+		{
+			name:     "empty namespace matches cluster-scoped requests only",
+			grants:   []string{"nodes:list:"},
+			attrs:    authorizer.AttributesRecord{Verb: "list", Resource: "nodes", ResourceRequest: true},
+			decision: authorizer.DecisionAllow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := mint.Token{Username: "agent"}
+			for _, grantString := range tt.grants {
+				grant, err := mint.ParseGrant(grantString)
+				if err != nil {
+					t.Fatalf("parsing grant: %v", err)
+				}
+				token.Grants = append(token.Grants, grant)
+			}
+
+			authz := NewBiscuit(store, nil, WithGrantMode(true))
+			decision, reason, err := authz.EvaluateToken(context.Background(), mintTestToken(t, key, token), tt.attrs)
+			if err != nil {
+				t.Fatalf("evaluating token: %v", err)
+			}
+
+			if decision != tt.decision {
+				t.Errorf("got decision %v (%q), want %v", decision, reason, tt.decision)
+			}
+		})
+	}
+}
+
+func TestCarryThroughDigestImpersonation(t *testing.T) {
+	key, store := newTestKeys(t)
+
+	root := mintTestToken(t, key, mint.Token{Username: "jane"})
+
+	tests := []struct {
+		name     string
+		token    string
+		revoked  bool
+		opts     []Option
+		decision authorizer.Decision
+	}{
+		{
+			name:     "left to RBAC",
+			token:    root,
+			decision: authorizer.DecisionNoOpinion,
+		},
+		{
+			name:     "denied by the token's verb check",
+			token:    attenuateTestToken(t, root, attenuation.Spec{Verbs: []string{"get"}}),
+			decision: authorizer.DecisionDeny,
+		},
+		{
+			name:     "denied by the token's impersonate check",
+			token:    attenuateTestToken(t, root, attenuation.Spec{Impersonate: []string{"user:alice"}}),
+			decision: authorizer.DecisionDeny,
+		},
+		{
+			name:     "denied once revoked",
+			token:    root,
+			revoked:  true,
+			decision: authorizer.DecisionDeny,
+		},
+		{
+			name: "allowed by a grant in grant mode",
+			token: mintTestToken(t, key, mint.Token{Username: "jane", Grants: []mint.Grant{
+				{APIGroup: authenticationv1.GroupName, Resource: "userextras", Subresource: tokencache.ExtraKey, Verb: "impersonate", Namespace: "*"},
+			}}),
+			opts:     []Option{WithGrantMode(true)},
+			decision: authorizer.DecisionAllow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := tokencache.New(time.Minute)
+			requester := cacheTestToken(t, cache, tt.token, &user.DefaultInfo{Name: "jane"})
+
+			opts := append([]Option{WithImpersonationCarryThrough(true)}, tt.opts...)
+			if tt.revoked {
+				b, err := tokenutil.Limits{}.Decode(tt.token)
+				if err != nil {
+					t.Fatalf("decoding token: %v", err)
+				}
+
+				path := filepath.Join(t.TempDir(), "revoked")
+				if err := os.WriteFile(path, []byte(hex.EncodeToString(b.RevocationIds()[0])+"\n"), 0o600); err != nil {
+					t.Fatalf("writing revocation list: %v", err)
+				}
+
+				list, err := revocation.NewList(path)
+				if err != nil {
+					t.Fatalf("loading revocation list: %v", err)
+				}
+				opts = append(opts, WithRevocationList(list))
+			}
+
+			authz := NewBiscuit(store, cache, opts...)
+			decision, reason, err := authz.Authorize(context.Background(), authorizer.AttributesRecord{
+				User:            requester,
+				Verb:            "impersonate",
+				APIGroup:        authenticationv1.GroupName,
+				Resource:        "userextras",
+				Subresource:     tokencache.ExtraKey,
+				Name:            requester.Extra[tokencache.ExtraKey][0],
+				ResourceRequest: true,
+			})
+			if err != nil {
+				t.Fatalf("authorizing: %v", err)
+			}
+
+			if decision != tt.decision {
+				t.Errorf("got decision %v (%q), want %v", decision, reason, tt.decision)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package authorizer
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/everettraven/biscuit/pkg/tokenutil"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// Explanation details how a token was evaluated against a request.
+type Explanation struct {
+	Decision     string         `json:"decision"`
+	Reason       string         `json:"reason,omitempty"`
+	RequestFacts []string       `json:"requestFacts"`
+	Checks       []CheckResult  `json:"checks"`
+	Policies     []PolicyResult `json:"policies"`
+	World        string         `json:"world,omitempty"`
+
+	// unattributed is set when the evaluation failed with an error
+	// naming no check, which Summary then reports as is.
+	unattributed bool
+}
+
+// CheckResult is the result of a check of the operator policy or of a
+// token block.
+type CheckResult struct {
+	Origin string `json:"origin"`
+	Index  int    `json:"index"`
+	Check  string `json:"check"`
+	Passed bool   `json:"passed"`
+}
+
+// PolicyResult is a policy, in evaluation order, its kind, allow or
+// deny, and whether it is the one that matched.
+type PolicyResult struct {
+	Policy  string `json:"policy"`
+	Kind    string `json:"kind"`
+	Matched bool   `json:"matched"`
+}
+
+const operatorPolicyOrigin = "operator policy"
+
+// Summary describes why the request was denied, naming the failed
+// checks and the matching deny policy.
+func (e *Explanation) Summary() string {
+	reasons := []string{}
+	if e.unattributed {
+		reasons = append(reasons, e.Reason)
+	}
+
+	for _, check := range e.Checks {
+		if !check.Passed {
+			reasons = append(reasons, fmt.Sprintf("%s check #%d failed: %s", check.Origin, check.Index, check.Check))
+		}
+	}
+
+	for _, policy := range e.Policies {
+		if policy.Matched && policy.Kind == policyKindDeny {
+			reasons = append(reasons, "matched "+policy.Policy)
+		}
+	}
+
+	if len(reasons) == 0 {
+		return e.Reason
+	}
+
+	return strings.Join(reasons, "; ")
+}
+
+// Explain explains the decision Authorize makes for the request.
+func (b *Biscuit) Explain(ctx context.Context, attrs authorizer.Attributes) (*Explanation, error) {
+	r := b.resolve(attrs)
+	if !r.evaluate {
+		return &Explanation{
+			Decision:     decisionString(r.decision),
+			Reason:       r.reason,
+			RequestFacts: requestFactStrings(attrs),
+			Checks:       []CheckResult{},
+			Policies:     []PolicyResult{},
+		}, nil
+	}
+
+	return b.explain(authenticator.WithAudiences(ctx, r.audiences), r.token, attrs, r.grant)
+}
+
+// ExplainToken evaluates the base64 encoded token against the request
+// attributes as EvaluateToken does, reporting the request facts, the
+// result of every check, the matching policy and the Datalog world.
+func (b *Biscuit) ExplainToken(ctx context.Context, token string, attrs authorizer.Attributes) (*Explanation, error) {
+	return b.explain(ctx, token, attrs, b.grantMode)
+}
+
+func (b *Biscuit) explain(ctx context.Context, token string, attrs authorizer.Attributes, grant bool) (*Explanation, error) {
+	biscToken, err := b.limits.Decode(token)
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := &Explanation{
+		RequestFacts: requestFactStrings(attrs),
+		Checks:       []CheckResult{},
+		Policies:     []PolicyResult{},
+	}
+
+	if b.revocations != nil {
+		if err := b.revocations.Check(biscToken); err != nil {
+			explanation.Decision, explanation.Reason = decisionString(authorizer.DecisionDeny), err.Error()
+			return explanation, nil
+		}
+	}
+
+	audiences, _ := authenticator.AudiencesFrom(ctx)
+
+	authz, policies, err := b.newAuthorizer(biscToken, attrs, grant, audiences)
+	if err != nil {
+		return nil, err
+	}
+
+	authzErr := tokenutil.WrapLimitError(authz.Authorize())
+
+	decision, reason, _ := decide(authzErr, grant)
+	explanation.Decision, explanation.Reason = decisionString(decision), reason
+	explanation.World = authz.PrintWorld()
+
+	failed := failedChecks(authzErr)
+	explanation.unattributed = isCheckError(authzErr) && len(failed) == 0
+
+	var operatorBlock biscuit.ParsedBlock
+	if b.policy != nil {
+		operatorBlock = b.policy.Current().Block
+	}
+
+	operatorChecks, policyStrings, err := datalogSource(operatorBlock.Checks, policies)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, check := range operatorChecks {
+		explanation.Checks = append(explanation.Checks, CheckResult{
+			Origin: operatorPolicyOrigin,
+			Index:  i,
+			Check:  check,
+			Passed: !failed[checkID{block: -1, index: i}],
+		})
+	}
+
+	blocks, err := tokenutil.Blocks(biscToken)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, block := range blocks {
+		for j, check := range block.Checks {
+			explanation.Checks = append(explanation.Checks, CheckResult{
+				Origin: fmt.Sprintf("block #%d", i),
+				Index:  j,
+				Check:  check,
+				Passed: !failed[checkID{block: i, index: j}],
+			})
+		}
+	}
+
+	matched := false
+	for i, policy := range policies {
+		result := PolicyResult{Policy: policyStrings[i], Kind: policyKind(policy)}
+
+		if !matched && !errors.Is(authzErr, tokenutil.ErrLimitExceeded) {
+			for _, query := range policy.Queries {
+				facts, err := authz.Query(query)
+				if err == nil && len(facts) > 0 {
+					result.Matched, matched = true, true
+					break
+				}
+			}
+		}
+
+		explanation.Policies = append(explanation.Policies, result)
+	}
+
+	return explanation, nil
+}
+
+type checkID struct {
+	block, index int
+}
+
+var failedCheckPattern = regexp.MustCompile(`failed to verify (?:block #?(\d+) )?check #(\d+)`)
+
+// isCheckError returns whether err, returned by
+// biscuit.Authorizer.Authorize, is neither a policy outcome nor an
+// exceeded limit, i.e. reports failed checks.
+func isCheckError(err error) bool {
+	return err != nil &&
+		!errors.Is(err, biscuit.ErrPolicyDenied) &&
+		!errors.Is(err, biscuit.ErrNoMatchingPolicy) &&
+		!errors.Is(err, tokenutil.ErrLimitExceeded)
+}
+
+// failedChecks returns the checks reported as failed by the error of
+// biscuit.Authorizer.Authorize. biscuit-go has no error values for failed
+// checks and only names them in its message, so they are parsed from it;
+// errors naming no check are reported by Summary as is. Checks of the
+// authorizer itself, i.e. of the operator policy, are reported with
+// block -1.
+func failedChecks(err error) map[checkID]bool {
+	failed := map[checkID]bool{}
+	if !isCheckError(err) {
+		return failed
+	}
+
+	for _, match := range failedCheckPattern.FindAllStringSubmatch(err.Error(), -1) {
+		id := checkID{block: -1}
+		if match[1] != "" {
+			id.block, _ = strconv.Atoi(match[1])
+		}
+		id.index, _ = strconv.Atoi(match[2])
+		failed[id] = true
+	}
+
+	return failed
+}
+
+// datalogSource prints checks and policies as Datalog source. biscuit-go
+// can only print the contents of tokens, so they are printed from a
+// throwaway token holding the checks and the policies' queries as checks.
+func datalogSource(checks []biscuit.Check, policies []biscuit.Policy) ([]string, []string, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating key: %w", err)
+	}
+
+	block := biscuit.ParsedBlock{Checks: append([]biscuit.Check{}, checks...)}
+	for _, policy := range policies {
+		block.Checks = append(block.Checks, biscuit.Check{Queries: policy.Queries})
+	}
+
+	builder := biscuit.NewBuilder(key)
+	if err := builder.AddBlock(block); err != nil {
+		return nil, nil, fmt.Errorf("printing policies: %w", err)
+	}
+
+	token, err := builder.Build()
+	if err != nil {
+		return nil, nil, fmt.Errorf("printing policies: %w", err)
+	}
+
+	blocks, err := tokenutil.Blocks(token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("printing policies: %w", err)
+	}
+
+	printed := blocks[0].Checks
+	policyStrings := make([]string, len(policies))
+	for i, policy := range policies {
+		policyStrings[i] = policyKind(policy) + strings.TrimPrefix(printed[len(checks)+i], "check")
+	}
+
+	return printed[:len(checks)], policyStrings, nil
+}
+
+const (
+	policyKindAllow = "allow"
+	policyKindDeny  = "deny"
+)
+
+func policyKind(policy biscuit.Policy) string {
+	if policy.Kind == biscuit.PolicyKindDeny {
+		return policyKindDeny
+	}
+	return policyKindAllow
+}
+
+func requestFactStrings(attrs authorizer.Attributes) []string {
+	facts := []string{}
+	for _, fact := range RequestFacts(attrs) {
+		facts = append(facts, fact.String())
+	}
+	return facts
+}
+
+func decisionString(decision authorizer.Decision) string {
+	switch decision {
+	case authorizer.DecisionAllow:
+		return "allow"
+	case authorizer.DecisionDeny:
+		return "deny"
+	default:
+		return "no opinion"
+	}
+}
@@ -0,0 +1,97 @@
+package authorizer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/biscuit-auth/biscuit-go/v2/parser"
+	"github.com/everettraven/biscuit/pkg/attenuation"
+	"github.com/everettraven/biscuit/pkg/mint"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+func TestExplainSummary(t *testing.T) {
+	key, store := newTestKeys(t)
+
+	namespaceCheck, err := parser.FromStringCheck(`check if k8s:namespace("default")`)
+	if err != nil {
+		t.Fatalf("parsing check: %v", err)
+	}
+
+	root := mintTestToken(t, key, mint.Token{Username: "jane"})
+
+	policyPath := filepath.Join(t.TempDir(), "policy.dl")
+	if err := os.WriteFile(policyPath, []byte(`deny if k8s:verb("delete");`+"\n"), 0o600); err != nil {
+		t.Fatalf("writing policy: %v", err)
+	}
+
+	policy, err := NewPolicyFile(policyPath)
+	if err != nil {
+		t.Fatalf("loading policy: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		token       string
+		opts        []Option
+		attrs       authorizer.AttributesRecord
+		wantSummary string
+		wantChecks  []CheckResult
+	}{
+		{
+			name:        "failing authority check",
+			token:       mintTestToken(t, key, mint.Token{Username: "jane", Checks: []biscuit.Check{namespaceCheck}}),
+			attrs:       authorizer.AttributesRecord{Verb: "get", Resource: "pods", Namespace: "kube-system", ResourceRequest: true},
+			wantSummary: `block #0 check #0 failed: check if k8s:namespace("default")`,
+			wantChecks: []CheckResult{
+				{Origin: "block #0", Index: 0, Check: `check if k8s:namespace("default")`},
+			},
+		},
+		{
+			name:        "failing block check",
+			token:       attenuateTestToken(t, root, attenuation.Spec{Verbs: []string{"get", "list"}}),
+			attrs:       authorizer.AttributesRecord{Verb: "delete", Resource: "pods", Namespace: "default", ResourceRequest: true},
+			wantSummary: `block #1 check #0 failed: check if k8s:verb("get") or k8s:verb("list")`,
+			wantChecks: []CheckResult{
+				{Origin: "block #1", Index: 0, Check: `check if k8s:verb("get") or k8s:verb("list")`},
+			},
+		},
+		{
+			name:        "matched deny policy",
+			token:       root,
+			opts:        []Option{WithPolicyFile(policy)},
+			attrs:       authorizer.AttributesRecord{Verb: "delete", Resource: "pods", Namespace: "default", ResourceRequest: true},
+			wantSummary: `matched deny if k8s:verb("delete")`,
+			wantChecks:  []CheckResult{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			explanation, err := NewBiscuit(store, nil, tt.opts...).ExplainToken(context.Background(), tt.token, tt.attrs)
+			if err != nil {
+				t.Fatalf("explaining token: %v", err)
+			}
+
+			if explanation.Decision != "deny" {
+				t.Errorf("got decision %q, want deny", explanation.Decision)
+			}
+
+			if got := explanation.Summary(); got != tt.wantSummary {
+				t.Errorf("got summary %q, want %q", got, tt.wantSummary)
+			}
+
+			if len(explanation.Checks) != len(tt.wantChecks) {
+				t.Fatalf("got checks %+v, want %+v", explanation.Checks, tt.wantChecks)
+			}
+			for i, check := range explanation.Checks {
+				if check != tt.wantChecks[i] {
+					t.Errorf("got check %+v, want %+v", check, tt.wantChecks[i])
+				}
+			}
+		})
+	}
+}
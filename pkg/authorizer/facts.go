@@ -0,0 +1,142 @@
+package authorizer
+
+import (
+	"github.com/biscuit-auth/biscuit-go/v2"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// RequestFacts returns the Datalog facts describing the request
+// attributes that attenuation checks are evaluated against.
+//
+// Resource requests always carry k8s:api_group, k8s:api_version,
+// k8s:subresource and k8s:namespace facts, using an empty string for the
+// core API group, for requests against the main resource and for
+// cluster-wide requests, so that checks can match on those values
+// explicitly (e.g. k8s:subresource("") to deny exec).
+//
+// Label and field selector requirements are emitted as
+// k8s:label_selector(key, operator, values) and
+// k8s:field_selector(field, operator, values) facts, where values is a
+// set. The "==" operator is normalized to "=". Selectors that fail to
+// parse produce no facts, so checks requiring them fail closed.
+//
+// Requests to impersonate carry a k8s:impersonate(kind, name) fact, see
+// impersonationFact.
+func RequestFacts(attrs authorizer.Attributes) []biscuit.Fact {
+	facts := []biscuit.Fact{
+		fact("k8s:resource_request", biscuit.Bool(attrs.IsResourceRequest())),
+	}
+
+	if !attrs.IsResourceRequest() {
+		if attrs.GetPath() != "" {
+			facts = append(facts, fact("k8s:path", biscuit.String(attrs.GetPath())))
+		}
+
+		if attrs.GetVerb() != "" {
+			facts = append(facts, fact("k8s:verb", biscuit.String(attrs.GetVerb())))
+		}
+
+		return facts
+	}
+
+	facts = append(facts,
+		fact("k8s:api_group", biscuit.String(attrs.GetAPIGroup())),
+		fact("k8s:api_version", biscuit.String(attrs.GetAPIVersion())),
+		fact("k8s:subresource", biscuit.String(attrs.GetSubresource())),
+		fact("k8s:namespace", biscuit.String(attrs.GetNamespace())),
+	)
+
+	if attrs.GetResource() != "" {
+		facts = append(facts, fact("k8s:resource", biscuit.String(attrs.GetResource())))
+	}
+
+	if attrs.GetName() != "" {
+		facts = append(facts, fact("k8s:name", biscuit.String(attrs.GetName())))
+	}
+
+	if attrs.GetVerb() != "" {
+		facts = append(facts, fact("k8s:verb", biscuit.String(attrs.GetVerb())))
+	}
+
+	if impersonation, ok := impersonationFact(attrs); ok {
+		facts = append(facts, impersonation)
+	}
+
+	if labelRequirements, err := attrs.GetLabelSelector(); err == nil {
+		for _, req := range labelRequirements {
+			facts = append(facts, fact("k8s:label_selector",
+				biscuit.String(req.Key()),
+				biscuit.String(normalizeOperator(req.Operator())),
+				stringSet(req.Values().List()...),
+			))
+		}
+	}
+
+	if fieldRequirements, err := attrs.GetFieldSelector(); err == nil {
+		for _, req := range fieldRequirements {
+			facts = append(facts, fact("k8s:field_selector",
+				biscuit.String(req.Field),
+				biscuit.String(normalizeOperator(req.Operator)),
+				stringSet(req.Value),
+			))
+		}
+	}
+
+	return facts
+}
+
+// impersonationFact describes a request to impersonate as a
+// k8s:impersonate(kind, name) fact. kind is one of "user", "group",
+// "serviceaccount", "uid" or "userextra". Service accounts are named by
+// their username, system:serviceaccount:<namespace>:<name>, and user
+// extras by "<key>=<value>".
+func impersonationFact(attrs authorizer.Attributes) (biscuit.Fact, bool) {
+	if attrs.GetVerb() != "impersonate" {
+		return biscuit.Fact{}, false
+	}
+
+	var kind, name string
+	switch {
+	case attrs.GetAPIGroup() == "" && attrs.GetResource() == "users":
+		kind, name = "user", attrs.GetName()
+	case attrs.GetAPIGroup() == "" && attrs.GetResource() == "groups":
+		kind, name = "group", attrs.GetName()
+	case attrs.GetAPIGroup() == "" && attrs.GetResource() == "serviceaccounts":
+		kind, name = "serviceaccount", serviceaccount.MakeUsername(attrs.GetNamespace(), attrs.GetName())
+	case attrs.GetAPIGroup() == authenticationv1.GroupName && attrs.GetResource() == "uids":
+		kind, name = "uid", attrs.GetName()
+	case attrs.GetAPIGroup() == authenticationv1.GroupName && attrs.GetResource() == "userextras":
+		kind, name = "userextra", attrs.GetSubresource()+"="+attrs.GetName()
+	default:
+		return biscuit.Fact{}, false
+	}
+
+	return fact("k8s:impersonate", biscuit.String(kind), biscuit.String(name)), true
+}
+
+func fact(name string, terms ...biscuit.Term) biscuit.Fact {
+	return biscuit.Fact{
+		Predicate: biscuit.Predicate{
+			Name: name,
+			IDs:  terms,
+		},
+	}
+}
+
+func stringSet(values ...string) biscuit.Set {
+	set := biscuit.Set{}
+	for _, value := range values {
+		set = append(set, biscuit.String(value))
+	}
+	return set
+}
+
+func normalizeOperator(op selection.Operator) string {
+	if op == selection.DoubleEquals {
+		return string(selection.Equals)
+	}
+	return string(op)
+}
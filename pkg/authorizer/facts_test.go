@@ -0,0 +1,92 @@
+package authorizer
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+func TestRequestFactsSelectors(t *testing.T) {
+	tests := []struct {
+		name          string
+		labelSelector string
+		fieldSelector string
+		labelErr      error
+		want          []string
+	}{
+		{
+			name:          "equals is normalized",
+			labelSelector: "app==frontend,tier=web",
+			want:          []string{`k8s:label_selector("app", "=", ["frontend"])`, `k8s:label_selector("tier", "=", ["web"])`},
+		},
+		{
+			name:          "in",
+			labelSelector: "app in (frontend,backend)",
+			want:          []string{`k8s:label_selector("app", "in", ["backend", "frontend"])`},
+		},
+		{
+			name:          "notin",
+			labelSelector: "app notin (db)",
+			want:          []string{`k8s:label_selector("app", "notin", ["db"])`},
+		},
+		{
+			name:          "exists",
+			labelSelector: "app",
+			want:          []string{`k8s:label_selector("app", "exists", [])`},
+		},
+		{
+			name:          "does not exist",
+			labelSelector: "!secret",
+			want:          []string{`k8s:label_selector("secret", "!", [])`},
+		},
+		{
+			name:          "field selectors",
+			fieldSelector: "spec.nodeName==node-1,metadata.name!=web",
+			want:          []string{`k8s:field_selector("metadata.name", "!=", ["web"])`, `k8s:field_selector("spec.nodeName", "=", ["node-1"])`},
+		},
+		{
+			name:     "unparsable selector",
+			labelErr: errors.New("invalid selector"),
+			want:     []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attrs := authorizer.AttributesRecord{Verb: "list", Resource: "pods", ResourceRequest: true, LabelSelectorParsingErr: tt.labelErr}
+
+			if tt.labelSelector != "" {
+				selector, err := labels.Parse(tt.labelSelector)
+				if err != nil {
+					t.Fatalf("parsing label selector: %v", err)
+				}
+				attrs.LabelSelectorRequirements, _ = selector.Requirements()
+			}
+
+			if tt.fieldSelector != "" {
+				selector, err := fields.ParseSelector(tt.fieldSelector)
+				if err != nil {
+					t.Fatalf("parsing field selector: %v", err)
+				}
+				attrs.FieldSelectorRequirements = selector.Requirements()
+			}
+
+			got := []string{}
+			for _, fact := range RequestFacts(attrs) {
+				if strings.HasSuffix(fact.Name, "_selector") {
+					got = append(got, fact.String())
+				}
+			}
+			slices.Sort(got)
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got facts %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package authorizer
+
+import (
+	"fmt"
+	"slices"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// matchIdentity reports an error unless requester is the identity the
+// token authenticated as. The username and UID must be equal and the
+// groups must be the same, except for system:authenticated, which the
+// API server adds to every authenticated user.
+func matchIdentity(authenticated, requester user.Info) error {
+	if authenticated.GetName() != requester.GetName() {
+		return fmt.Errorf("token was issued to user %q, not %q", authenticated.GetName(), requester.GetName())
+	}
+
+	if authenticated.GetUID() != requester.GetUID() {
+		return fmt.Errorf("token was issued to UID %q, not %q", authenticated.GetUID(), requester.GetUID())
+	}
+
+	for _, group := range authenticated.GetGroups() {
+		if !slices.Contains(requester.GetGroups(), group) {
+			return fmt.Errorf("requester is missing group %q of the token", group)
+		}
+	}
+
+	for _, group := range requester.GetGroups() {
+		if group != user.AllAuthenticated && !slices.Contains(authenticated.GetGroups(), group) {
+			return fmt.Errorf("requester has group %q not in the token", group)
+		}
+	}
+
+	return nil
+}
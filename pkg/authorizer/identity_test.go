@@ -0,0 +1,181 @@
+package authorizer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/everettraven/biscuit/pkg/identitypolicy"
+	"github.com/everettraven/biscuit/pkg/mint"
+	"github.com/everettraven/biscuit/pkg/tokencache"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+func TestMatchIdentity(t *testing.T) {
+	authenticated := &user.DefaultInfo{Name: "jane", UID: "1234", Groups: []string{"dev", "ops"}}
+
+	tests := []struct {
+		name      string
+		requester *user.DefaultInfo
+		wantErr   bool
+	}{
+		{
+			name:      "same identity",
+			requester: &user.DefaultInfo{Name: "jane", UID: "1234", Groups: []string{"ops", "dev"}},
+		},
+		{
+			name:      "system:authenticated is exempt",
+			requester: &user.DefaultInfo{Name: "jane", UID: "1234", Groups: []string{"dev", "ops", user.AllAuthenticated}},
+		},
+		{
+			name:      "different username",
+			requester: &user.DefaultInfo{Name: "alice", UID: "1234", Groups: []string{"dev", "ops"}},
+			wantErr:   true,
+		},
+		{
+			name:      "different UID",
+			requester: &user.DefaultInfo{Name: "jane", UID: "5678", Groups: []string{"dev", "ops"}},
+			wantErr:   true,
+		},
+		{
+			name:      "missing UID",
+			requester: &user.DefaultInfo{Name: "jane", Groups: []string{"dev", "ops"}},
+			wantErr:   true,
+		},
+		{
+			name:      "missing group",
+			requester: &user.DefaultInfo{Name: "jane", UID: "1234", Groups: []string{"dev"}},
+			wantErr:   true,
+		},
+		{
+			name:      "extra group",
+			requester: &user.DefaultInfo{Name: "jane", UID: "1234", Groups: []string{"dev", "ops", "system:masters"}},
+			wantErr:   true,
+		},
+		{
+			name:      "system:authenticated does not stand in for a token group",
+			requester: &user.DefaultInfo{Name: "jane", UID: "1234", Groups: []string{"dev", user.AllAuthenticated}},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := matchIdentity(authenticated, tt.requester)
+			if tt.wantErr && err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	key, store := newTestKeys(t)
+
+	identity := &user.DefaultInfo{Name: "jane", UID: "1234", Groups: []string{"dev"}}
+	token := mintTestToken(t, key, mint.Token{Username: identity.Name, UID: identity.UID, Groups: identity.Groups})
+
+	cache := tokencache.New(time.Minute)
+	requester := cacheTestToken(t, cache, token, identity)
+	digest := requester.Extra[tokencache.ExtraKey]
+
+	prefixed := identitypolicy.Prefixes{Username: "biscuit:", Group: "biscuit:"}.Apply(requester)
+
+	tests := []struct {
+		name      string
+		cache     *tokencache.Cache
+		opts      []Option
+		requester user.Info
+		want      resolution
+	}{
+		{
+			name:      "no digest is left to the other authorizers",
+			cache:     cache,
+			requester: identity,
+			want:      resolution{decision: authorizer.DecisionNoOpinion},
+		},
+		{
+			name:      "matching identity is evaluated",
+			cache:     cache,
+			requester: requester,
+			want:      resolution{evaluate: true, token: token},
+		},
+		{
+			name:      "matching identity is evaluated with grants in grant mode",
+			cache:     cache,
+			opts:      []Option{WithGrantMode(true)},
+			requester: requester,
+			want:      resolution{evaluate: true, token: token, grant: true},
+		},
+		{
+			name:      "matching identity is evaluated once the prefixes are stripped",
+			cache:     cache,
+			opts:      []Option{WithPrefixes(identitypolicy.Prefixes{Username: "biscuit:", Group: "biscuit:"})},
+			requester: prefixed,
+			want:      resolution{evaluate: true, token: token},
+		},
+		{
+			name:      "missing prefix is denied",
+			cache:     cache,
+			opts:      []Option{WithPrefixes(identitypolicy.Prefixes{Username: "biscuit:", Group: "biscuit:"})},
+			requester: requester,
+			want:      resolution{decision: authorizer.DecisionDeny},
+		},
+		{
+			name:      "unknown digest fails closed",
+			cache:     cache,
+			requester: &user.DefaultInfo{Name: "jane", UID: "1234", Groups: []string{"dev"}, Extra: map[string][]string{tokencache.ExtraKey: {"unknown"}}},
+			want:      resolution{decision: authorizer.DecisionDeny},
+		},
+		{
+			name:      "missing cache fails closed",
+			requester: requester,
+			want:      resolution{decision: authorizer.DecisionDeny},
+		},
+		{
+			name:      "other identity is denied",
+			cache:     cache,
+			requester: &user.DefaultInfo{Name: "alice", Groups: []string{"dev"}, Extra: map[string][]string{tokencache.ExtraKey: digest}},
+			want:      resolution{decision: authorizer.DecisionDeny},
+		},
+		{
+			name:      "other identity is evaluated without grants when carrying the checks through",
+			cache:     cache,
+			opts:      []Option{WithImpersonationCarryThrough(true), WithGrantMode(true)},
+			requester: &user.DefaultInfo{Name: "alice", Groups: []string{"dev"}, Extra: map[string][]string{tokencache.ExtraKey: digest}},
+			want:      resolution{evaluate: true, token: token, grant: false},
+		},
+		{
+			name:      "missing prefix is evaluated without grants when carrying the checks through",
+			cache:     cache,
+			opts:      []Option{WithImpersonationCarryThrough(true), WithGrantMode(true), WithPrefixes(identitypolicy.Prefixes{Username: "biscuit:"})},
+			requester: requester,
+			want:      resolution{evaluate: true, token: token, grant: false},
+		},
+		{
+			name:      "unknown digest fails closed when carrying the checks through",
+			cache:     cache,
+			opts:      []Option{WithImpersonationCarryThrough(true)},
+			requester: &user.DefaultInfo{Name: "alice", Extra: map[string][]string{tokencache.ExtraKey: {"unknown"}}},
+			want:      resolution{decision: authorizer.DecisionDeny},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewBiscuit(store, tt.cache, tt.opts...).resolve(authorizer.AttributesRecord{User: tt.requester})
+
+			if got.evaluate != tt.want.evaluate || got.token != tt.want.token || got.grant != tt.want.grant || got.decision != tt.want.decision {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+
+			if !got.evaluate && got.decision == authorizer.DecisionDeny && got.reason == "" {
+				t.Error("expected a reason for the denial")
+			}
+		})
+	}
+}
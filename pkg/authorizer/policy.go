@@ -0,0 +1,173 @@
+package authorizer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/biscuit-auth/biscuit-go/v2/parser"
+	"github.com/everettraven/biscuit/pkg/filewatch"
+)
+
+// PolicyFile holds an operator supplied Datalog policy, made of facts,
+// rules, checks and ordered allow/deny policies, that is added to every
+// token evaluation ahead of the built-in policy.
+type PolicyFile struct {
+	path    string
+	loaded  []byte
+	current atomic.Pointer[biscuit.ParsedAuthorizer]
+}
+
+// NewPolicyFile loads and validates the policy at path.
+func NewPolicyFile(path string) (*PolicyFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy file: %w", err)
+	}
+
+	policy, err := ParsePolicy(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	pf := &PolicyFile{path: path, loaded: data}
+	pf.current.Store(policy)
+
+	return pf, nil
+}
+
+// Watch reloads the policy whenever the file changes, until ctx is
+// cancelled. If the new policy fails to parse, the previous one is kept.
+func (pf *PolicyFile) Watch(ctx context.Context, interval time.Duration) {
+	filewatch.Poll(ctx, pf.path, interval, pf.loaded, func(data []byte) {
+		policy, err := ParsePolicy(string(data))
+		if err != nil {
+			log.Printf("keeping previous policy, new policy is invalid: %v\n", err)
+			return
+		}
+
+		pf.current.Store(policy)
+		log.Printf("reloaded policy file %s\n", pf.path)
+	})
+}
+
+// Current returns the most recently loaded valid policy.
+func (pf *PolicyFile) Current() *biscuit.ParsedAuthorizer {
+	return pf.current.Load()
+}
+
+// ParsePolicy parses Datalog authorizer source. biscuit-go's parser
+// panics on deny policies, so they are parsed as allow policies and
+// their kind is restored afterwards. It also only accepts comments at
+// the start of the source, so comments are removed before parsing.
+func ParsePolicy(source string) (policy *biscuit.ParsedAuthorizer, err error) {
+	rewritten, denies := preprocessPolicy(source)
+
+	defer func() {
+		if r := recover(); r != nil {
+			policy, err = nil, fmt.Errorf("parsing policy: %v", r)
+		}
+	}()
+
+	parsed, err := parser.FromStringAuthorizer(rewritten)
+	if err != nil {
+		return nil, fmt.Errorf("parsing policy: %w", err)
+	}
+
+	if len(parsed.Policies) != len(denies) {
+		return nil, fmt.Errorf("parsing policy: found %d policies, expected %d", len(parsed.Policies), len(denies))
+	}
+
+	for i, deny := range denies {
+		if deny {
+			parsed.Policies[i].Kind = biscuit.PolicyKindDeny
+		}
+	}
+
+	return &parsed, nil
+}
+
+// preprocessPolicy removes comments from source and replaces every
+// "allow if" and "deny if" keyword outside of strings, with any
+// whitespace between the words, with "allow if", reporting for each
+// policy keyword, in order, whether it was a deny policy.
+func preprocessPolicy(source string) (string, []bool) {
+	var out strings.Builder
+	denies := []bool{}
+
+	for i := 0; i < len(source); {
+		rest := source[i:]
+		switch {
+		case rest[0] == '"':
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				end = len(rest) - 2
+			}
+			out.WriteString(rest[:end+2])
+			i += end + 2
+		case strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			i += end
+		case i > 0 && isIdentByte(source[i-1]):
+			out.WriteByte(rest[0])
+			i++
+		case policyKeyword(rest, "allow") > 0:
+			n := policyKeyword(rest, "allow")
+			denies = append(denies, false)
+			writePolicyKeyword(&out, rest[:n])
+			i += n
+		case policyKeyword(rest, "deny") > 0:
+			n := policyKeyword(rest, "deny")
+			denies = append(denies, true)
+			writePolicyKeyword(&out, rest[:n])
+			i += n
+		default:
+			out.WriteByte(rest[0])
+			i++
+		}
+	}
+
+	return out.String(), denies
+}
+
+// policyKeyword returns the length of the policy keyword at the start of
+// source, kind followed by whitespace and "if", or 0 if there is none.
+func policyKeyword(source, kind string) int {
+	rest, ok := strings.CutPrefix(source, kind)
+	if !ok {
+		return 0
+	}
+
+	trimmed := strings.TrimLeft(rest, " \t\r\n")
+	if len(trimmed) == len(rest) || !strings.HasPrefix(trimmed, "if") {
+		return 0
+	}
+
+	n := len(source) - len(trimmed) + len("if")
+	if n < len(source) && isIdentByte(source[n]) {
+		return 0
+	}
+
+	return n
+}
+
+// writePolicyKeyword writes "allow if", the only spelling the parser
+// accepts, followed by the newlines of keyword so that the line numbers
+// of parse errors still match the source.
+func writePolicyKeyword(out *strings.Builder, keyword string) {
+	out.WriteString("allow if")
+	out.WriteString(strings.Repeat("\n", strings.Count(keyword, "\n")))
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == ':' || c == '$' || c == '{' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
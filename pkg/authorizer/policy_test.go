@@ -0,0 +1,101 @@
+package authorizer
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+)
+
+func TestPreprocessPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		want       string
+		wantDenies []bool
+	}{
+		{
+			name:       "allow and deny",
+			source:     "deny if k8s:verb(\"delete\");\nallow if true;",
+			want:       "allow if k8s:verb(\"delete\");\nallow if true;",
+			wantDenies: []bool{true, false},
+		},
+		{
+			name:       "several spaces",
+			source:     "deny   if true;\nallow  if true;",
+			want:       "allow if true;\nallow if true;",
+			wantDenies: []bool{true, false},
+		},
+		{
+			name:       "tabs and newlines",
+			source:     "deny\n\tif true;\nallow\tif true;",
+			want:       "allow if\n true;\nallow if true;",
+			wantDenies: []bool{true, false},
+		},
+		{
+			name:       "keywords inside strings",
+			source:     "deny if k8s:resource(\"deny if\"), k8s:verb(\"allow if\");",
+			want:       "allow if k8s:resource(\"deny if\"), k8s:verb(\"allow if\");",
+			wantDenies: []bool{true},
+		},
+		{
+			name:       "keywords inside comments",
+			source:     "// deny if everything\nallow if true; // deny if nothing",
+			want:       "\nallow if true; ",
+			wantDenies: []bool{false},
+		},
+		{
+			name:       "keywords inside identifiers",
+			source:     "check if k8s:deny_if(true), $allow if true;",
+			want:       "check if k8s:deny_if(true), $allow if true;",
+			wantDenies: []bool{},
+		},
+		{
+			name:       "keyword prefix of an identifier",
+			source:     "deny ifx",
+			want:       "deny ifx",
+			wantDenies: []bool{},
+		},
+		{
+			name:       "no whitespace",
+			source:     "denyif true;",
+			want:       "denyif true;",
+			wantDenies: []bool{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, denies := preprocessPolicy(tt.source)
+			if got != tt.want {
+				t.Errorf("got source %q, want %q", got, tt.want)
+			}
+
+			if !slices.Equal(denies, tt.wantDenies) {
+				t.Errorf("got denies %v, want %v", denies, tt.wantDenies)
+			}
+		})
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy(`
+		// operators may not delete anything
+		deny
+			if k8s:verb("delete");
+		allow  if k8s:resource("deny if");
+	`)
+	if err != nil {
+		t.Fatalf("parsing policy: %v", err)
+	}
+
+	kinds := []biscuit.PolicyKind{}
+	for _, policy := range policy.Policies {
+		kinds = append(kinds, policy.Kind)
+	}
+
+	want := []biscuit.PolicyKind{biscuit.PolicyKindDeny, biscuit.PolicyKindAllow}
+	if !slices.Equal(kinds, want) {
+		t.Errorf("got policy kinds %v, want %v", kinds, want)
+	}
+}
@@ -1,14 +1,14 @@
 package cmd
 
 import (
-	"crypto/rand"
 	"encoding/base64"
 	"fmt"
-	"strings"
+	"time"
 
-	"github.com/biscuit-auth/biscuit-go/v2"
-	"github.com/biscuit-auth/biscuit-go/v2/parser"
+	"github.com/everettraven/biscuit/pkg/attenuation"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func NewAttenuateCommand() *cobra.Command {
@@ -28,20 +28,34 @@ func NewAttenuateCommand() *cobra.Command {
 	}
 
 	cmd.Flags().StringVar(&attenuator.token, "token", "", "sets token for attenuation")
-	cmd.Flags().StringArrayVar(&attenuator.resource, "resource", []string{}, "sets resources for attenuation")
-	cmd.Flags().StringArrayVar(&attenuator.namespace, "namespace", []string{}, "sets namespaces for attenuation")
-	cmd.Flags().StringArrayVar(&attenuator.name, "name", []string{}, "sets names for attenuation")
-	cmd.Flags().StringArrayVar(&attenuator.verb, "verb", []string{}, "sets verbs for attenuation")
+	attenuator.AddFlags(cmd.Flags())
 
 	return cmd
 }
 
+func (a *attenuator) AddFlags(fs *pflag.FlagSet) {
+	fs.StringArrayVar(&a.spec.Resources, "resource", []string{}, "sets resources for attenuation")
+	fs.StringArrayVar(&a.spec.Namespaces, "namespace", []string{}, "sets namespaces for attenuation")
+	fs.StringArrayVar(&a.spec.Names, "name", []string{}, "sets names for attenuation")
+	fs.StringArrayVar(&a.spec.Verbs, "verb", []string{}, "sets verbs for attenuation")
+	fs.StringArrayVar(&a.spec.APIGroups, "api-group", []string{}, "sets API groups for attenuation. An empty string matches the core API group")
+	fs.StringArrayVar(&a.spec.APIVersions, "api-version", []string{}, "sets API versions for attenuation")
+	fs.StringArrayVar(&a.spec.Subresources, "subresource", []string{}, "sets subresources for attenuation. An empty string matches requests for the main resource")
+	fs.StringArrayVar(&a.spec.Paths, "path", []string{}, "sets non-resource URL paths for attenuation. A trailing '*' matches any path with the given prefix. When set, resource checks only apply to resource requests")
+	fs.StringArrayVar(&a.spec.LabelSelectors, "label-selector", []string{}, "sets label selectors that list, watch and deletecollection requests must be restricted by, e.g. 'app=frontend' or 'tier in (web,api)'. Such requests without a matching label selector are denied")
+	fs.StringArrayVar(&a.spec.FieldSelectors, "field-selector", []string{}, "sets field selectors that list, watch and deletecollection requests must be restricted by, e.g. 'spec.nodeName=node-1'. Such requests without a matching field selector are denied")
+	fs.StringArrayVar(&a.spec.Impersonate, "impersonate", []string{}, "sets identities that may be impersonated, in the form KIND:NAME where KIND is one of user, group, serviceaccount, uid or userextra. Service accounts are named system:serviceaccount:NAMESPACE:NAME and user extras KEY=VALUE. Impersonating any other identity is denied")
+	fs.StringArrayVar(&a.spec.Audiences, "audience", []string{}, "sets audiences for attenuation. The token is only authenticated by TokenReviews for one of them")
+	fs.StringArrayVar(&a.spec.Checks, "check", []string{}, "adds a Datalog check, e.g. 'check if k8s:namespace($ns), $ns.starts_with(\"team-\")'")
+	a.validity.AddFlags(fs)
+	fs.BoolVar(&a.spec.ResourceRequestsOnly, "resource-requests-only", false, "denies all non-resource requests")
+	fs.BoolVar(&a.spec.Seal, "seal", false, "seals the attenuated token so that it cannot be attenuated further")
+}
+
 type attenuator struct {
-	token     string
-	resource  []string
-	namespace []string
-	name      []string
-	verb      []string
+	token    string
+	spec     attenuation.Spec
+	validity validity
 }
 
 func (a attenuator) Attenuate() ([]byte, error) {
@@ -50,87 +64,20 @@ func (a attenuator) Attenuate() ([]byte, error) {
 		return nil, fmt.Errorf("decoding token: %w", err)
 	}
 
-	token, err := biscuit.Unmarshal(decodedToken)
-	if err != nil {
-		return nil, fmt.Errorf("unmarshalling token: %w", err)
-	}
-
-	checks := []biscuit.Check{}
-
-	if len(a.resource) > 0 {
-		var checkString strings.Builder
-		checkString.WriteString(fmt.Sprintf("check if k8s:resource(%q)", a.resource[0]))
-		for _, res := range a.resource[1:] {
-			checkString.WriteString(fmt.Sprintf(" or k8s:resource(%q)", res))
-		}
-
-		check, err := parser.FromStringCheck(checkString.String())
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse resource check: %v", err)
-		}
-
-		checks = append(checks, check)
-	}
-
-	if len(a.namespace) > 0 {
-		var checkString strings.Builder
-		checkString.WriteString(fmt.Sprintf("check if k8s:namespace(%q)", a.namespace[0]))
-		for _, res := range a.namespace[1:] {
-			checkString.WriteString(fmt.Sprintf(" or k8s:namespace(%q)", res))
-		}
-
-		check, err := parser.FromStringCheck(checkString.String())
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse namespace check: %v", err)
-		}
-
-		checks = append(checks, check)
-	}
+	now := time.Now()
 
-	if len(a.name) > 0 {
-		var checkString strings.Builder
-		checkString.WriteString(fmt.Sprintf("check if k8s:name(%q)", a.name[0]))
-		for _, res := range a.name[1:] {
-			checkString.WriteString(fmt.Sprintf(" or k8s:name(%q)", res))
-		}
-
-		check, err := parser.FromStringCheck(checkString.String())
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse name check: %v", err)
-		}
-
-		checks = append(checks, check)
-	}
-
-	if len(a.verb) > 0 {
-		var checkString strings.Builder
-		checkString.WriteString(fmt.Sprintf("check if k8s:verb(%q)", a.verb[0]))
-		for _, res := range a.verb[1:] {
-			checkString.WriteString(fmt.Sprintf(" or k8s:verb(%q)", res))
-		}
-
-		check, err := parser.FromStringCheck(checkString.String())
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse verb check: %v", err)
-		}
-
-		checks = append(checks, check)
-	}
-
-	blockBuilder := token.CreateBlock()
-	for _, check := range checks {
-		blockBuilder.AddCheck(check)
-	}
-
-	b2, err := token.Append(rand.Reader, blockBuilder.Build())
+	expiresAt, notBefore, err := a.validity.Times(now)
 	if err != nil {
-		return nil, fmt.Errorf("failed to append: %v", err)
+		return nil, err
 	}
 
-	token2, err := b2.Serialize()
-	if err != nil {
-		return nil, fmt.Errorf("failed to serialize biscuit: %v", err)
+	spec := a.spec
+	if !expiresAt.IsZero() {
+		spec.ExpiresAt = &metav1.Time{Time: expiresAt}
+	}
+	if !notBefore.IsZero() {
+		spec.NotBefore = &metav1.Time{Time: notBefore}
 	}
 
-	return token2, nil
+	return attenuation.Attenuate(decodedToken, spec, now)
 }
@@ -1,15 +1,18 @@
 package cmd
 
 import (
-	"crypto/ed25519"
-	"encoding/base64"
+	"context"
 	"fmt"
-	"os"
-	"strings"
 
-	"github.com/biscuit-auth/biscuit-go/v2"
-	"github.com/biscuit-auth/biscuit-go/v2/parser"
+	localauthorizer "github.com/everettraven/biscuit/pkg/authorizer"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/everettraven/biscuit/pkg/revocation"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	kauthorizer "k8s.io/apiserver/pkg/authorization/authorizer"
 )
 
 func NewAuthorizeCommand() *cobra.Command {
@@ -21,80 +24,144 @@ func NewAuthorizeCommand() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVar(&authorizer.token, "token", "", "sets token for authorization")
-	cmd.Flags().StringVar(&authorizer.pubKeyFile, "public-key-file", "biscuit-key.pub", "sets public key file for token verification")
-	cmd.Flags().StringVar(&authorizer.resource, "resource", "", "sets resource for authorization")
-	cmd.Flags().StringVar(&authorizer.namespace, "namespace", "", "sets namespace for authorization")
-	cmd.Flags().StringVar(&authorizer.name, "name", "", "sets name for authorization")
-	cmd.Flags().StringVar(&authorizer.verb, "verb", "", "sets verb for authorization")
+	authorizer.AddFlags(cmd.Flags())
 
 	return cmd
 }
 
+func (a *authorizer) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&a.token, "token", "", "sets token for authorization")
+	fs.StringArrayVar(&a.pubKeyFiles, "public-key-file", []string{"biscuit-key.pub"}, "sets public key files, or directories of *.pub files, for token verification")
+	fs.StringVar(&a.resource, "resource", "", "sets resource for authorization")
+	fs.StringVar(&a.namespace, "namespace", "", "sets namespace for authorization")
+	fs.StringVar(&a.name, "name", "", "sets name for authorization")
+	fs.StringVar(&a.verb, "verb", "", "sets verb for authorization")
+	fs.StringVar(&a.apiGroup, "api-group", "", "sets API group for authorization")
+	fs.StringVar(&a.apiVersion, "api-version", "", "sets API version for authorization")
+	fs.StringVar(&a.subresource, "subresource", "", "sets subresource for authorization")
+	fs.StringVar(&a.path, "path", "", "sets non-resource URL path for authorization. When set, the request is treated as a non-resource request")
+	fs.StringVar(&a.labelSelector, "label-selector", "", "sets label selector for authorization")
+	fs.StringVar(&a.fieldSelector, "field-selector", "", "sets field selector for authorization")
+	fs.StringVar(&a.policyFile, "policy-file", "", "sets a Datalog policy file to evaluate alongside the token, as the webhook does")
+	fs.StringVar(&a.revocationList, "revocation-list", "", "sets a revocation list to check the token against, as the webhook does")
+	fs.BoolVar(&a.grantMode, "grant-mode", false, "evaluates the token as the webhook does in grant mode, reporting whether the token grants the request")
+	fs.StringArrayVar(&a.audiences, "audience", []string{}, "sets audiences the token is evaluated for, as if authenticated for them")
+}
+
 type authorizer struct {
-	token      string
-	pubKeyFile string
-	resource   string
-	namespace  string
-	name       string
-	verb       string
+	token       string
+	pubKeyFiles []string
+	resource    string
+	namespace   string
+	name        string
+	verb        string
+	apiGroup    string
+	apiVersion  string
+	subresource string
+	path        string
+
+	labelSelector string
+	fieldSelector string
+
+	grantMode      bool
+	policyFile     string
+	revocationList string
+	audiences      []string
 }
 
 func (a authorizer) Authorize() error {
-	decodedToken, err := base64.URLEncoding.DecodeString(a.token)
+	attrs, err := a.attributes()
 	if err != nil {
-		return fmt.Errorf("decoding token: %w", err)
+		return err
 	}
 
-	token, err := biscuit.Unmarshal(decodedToken)
+	authz, err := a.newBiscuit()
 	if err != nil {
-		return fmt.Errorf("unmarshalling token: %w", err)
+		return err
 	}
 
-	publicKeyBytes, err := os.ReadFile(a.pubKeyFile)
+	decision, _, err := authz.EvaluateToken(a.context(), a.token, attrs)
 	if err != nil {
-		return fmt.Errorf("reading public key file: %w", err)
+		return err
 	}
 
-	publicRoot := ed25519.PublicKey(publicKeyBytes)
+	switch {
+	case decision == kauthorizer.DecisionDeny:
+		fmt.Println("forbidden")
+	case decision == kauthorizer.DecisionNoOpinion && a.grantMode:
+		fmt.Println("no opinion")
+	default:
+		fmt.Println("allowed")
+	}
 
-	var blockString strings.Builder
+	return nil
+}
 
-	if a.resource != "" {
-		blockString.WriteString(fmt.Sprintf("k8s:resource(%q);\n", a.resource))
-	}
+// newBiscuit returns an authorizer configured as the webhook would be
+// with the same flags.
+func (a authorizer) newBiscuit() (*localauthorizer.Biscuit, error) {
+	opts := []localauthorizer.Option{localauthorizer.WithGrantMode(a.grantMode)}
 
-	if a.namespace != "" {
-		blockString.WriteString(fmt.Sprintf("k8s:namespace(%q);\n", a.namespace))
-	}
+	if a.policyFile != "" {
+		policy, err := localauthorizer.NewPolicyFile(a.policyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading policy file: %w", err)
+		}
 
-	if a.name != "" {
-		blockString.WriteString(fmt.Sprintf("k8s:name(%q);\n", a.name))
+		opts = append(opts, localauthorizer.WithPolicyFile(policy))
 	}
 
-	if a.verb != "" {
-		blockString.WriteString(fmt.Sprintf("k8s:verb(%q);\n", a.verb))
-	}
+	if a.revocationList != "" {
+		revocations, err := revocation.NewList(a.revocationList)
+		if err != nil {
+			return nil, fmt.Errorf("loading revocation list: %w", err)
+		}
 
-	blockString.WriteString("allow if true;\n")
+		opts = append(opts, localauthorizer.WithRevocationList(revocations))
+	}
 
-	v1, err := token.Authorizer(publicRoot)
+	publicKeys, err := keys.NewStore(a.pubKeyFiles)
 	if err != nil {
-		panic(fmt.Errorf("failed to create verifier: %v", err))
+		return nil, fmt.Errorf("loading public keys: %w", err)
 	}
 
-	authorizer, err := parser.FromStringAuthorizer(blockString.String())
-	if err != nil {
-		panic(fmt.Errorf("failed to parse authorizer: %v", err))
+	return localauthorizer.NewBiscuit(publicKeys, nil, opts...), nil
+}
+
+// context returns the context tokens are evaluated in, carrying the
+// audiences they are evaluated for.
+func (a authorizer) context() context.Context {
+	return authenticator.WithAudiences(context.Background(), a.audiences)
+}
+
+func (a authorizer) attributes() (kauthorizer.AttributesRecord, error) {
+	attrs := kauthorizer.AttributesRecord{
+		Verb:            a.verb,
+		Namespace:       a.namespace,
+		APIGroup:        a.apiGroup,
+		APIVersion:      a.apiVersion,
+		Resource:        a.resource,
+		Subresource:     a.subresource,
+		Name:            a.name,
+		ResourceRequest: a.path == "",
+		Path:            a.path,
 	}
 
-	v1.AddAuthorizer(authorizer)
+	if a.labelSelector != "" {
+		selector, err := labels.Parse(a.labelSelector)
+		if err != nil {
+			return attrs, fmt.Errorf("parsing label selector: %w", err)
+		}
+		attrs.LabelSelectorRequirements, _ = selector.Requirements()
+	}
 
-	if err := v1.Authorize(); err != nil {
-		fmt.Println("forbidden")
-	} else {
-		fmt.Println("allowed")
+	if a.fieldSelector != "" {
+		selector, err := fields.ParseSelector(a.fieldSelector)
+		if err != nil {
+			return attrs, fmt.Errorf("parsing field selector: %w", err)
+		}
+		attrs.FieldSelectorRequirements = selector.Requirements()
 	}
 
-	return nil
+	return attrs, nil
 }
@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kauthorizer "k8s.io/apiserver/pkg/authorization/authorizer"
+	"sigs.k8s.io/yaml"
+)
+
+func NewCanICommand() *cobra.Command {
+	canI := canI{}
+	cmd := &cobra.Command{
+		Use: "can-i",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return canI.List(os.Stdout)
+		},
+	}
+
+	cmd.Flags().StringVar(&canI.token, "token", "", "sets token for authorization")
+	cmd.Flags().StringArrayVar(&canI.pubKeyFiles, "public-key-file", []string{"biscuit-key.pub"}, "sets public key files, or directories of *.pub files, for token verification")
+	cmd.Flags().StringVar(&canI.policyFile, "policy-file", "", "sets a Datalog policy file to evaluate alongside the token, as the webhook does")
+	cmd.Flags().StringVar(&canI.revocationList, "revocation-list", "", "sets a revocation list to check the token against, as the webhook does")
+	cmd.Flags().BoolVar(&canI.grantMode, "grant-mode", false, "evaluates the token as the webhook does in grant mode, reporting whether the token grants each request")
+	cmd.Flags().StringArrayVar(&canI.audiences, "audience", []string{}, "sets audiences the token is evaluated for, as if authenticated for them")
+	cmd.Flags().StringArrayVar(&canI.verbs, "verb", []string{}, "sets a verb to evaluate. May be repeated. Defaults to the verbs of each resource in the discovery file")
+	cmd.Flags().StringArrayVar(&canI.resources, "resource", []string{}, "sets a resource to evaluate, as resource[.group][/subresource]. May be repeated")
+	cmd.Flags().StringArrayVar(&canI.namespaces, "namespace", []string{""}, "sets a namespace to evaluate. May be repeated. Cluster-scoped resources from the discovery file are only evaluated without a namespace")
+	cmd.Flags().StringArrayVar(&canI.names, "name", []string{""}, "sets a resource name to evaluate. May be repeated")
+	cmd.Flags().StringVar(&canI.discoveryFile, "discovery-file", "", "sets a file containing an APIResourceList, or a JSON array of them, e.g. from kubectl get --raw /api/v1, listing resources to evaluate")
+	cmd.Flags().StringVarP(&canI.output, "output", "o", "text", "sets the output format, one of text, json or yaml")
+
+	return cmd
+}
+
+type canI struct {
+	authorizer
+	verbs         []string
+	resources     []string
+	namespaces    []string
+	names         []string
+	discoveryFile string
+	output        string
+}
+
+// canIResource is a resource to evaluate and the verbs it supports, if
+// known from discovery.
+type canIResource struct {
+	group       string
+	version     string
+	resource    string
+	subresource string
+	namespaced  bool
+	verbs       []string
+}
+
+type canIResult struct {
+	Verb        string `json:"verb"`
+	APIGroup    string `json:"apiGroup"`
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource,omitempty"`
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	Result      string `json:"result"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+func (c canI) List(out io.Writer) error {
+	resources, err := c.resourceList()
+	if err != nil {
+		return err
+	}
+
+	if len(resources) == 0 {
+		return fmt.Errorf("no resources to evaluate, set --resource or --discovery-file")
+	}
+
+	authz, err := c.newBiscuit()
+	if err != nil {
+		return err
+	}
+
+	results := []canIResult{}
+
+	for _, resource := range resources {
+		verbs := c.verbs
+		if len(verbs) == 0 {
+			verbs = resource.verbs
+		}
+
+		if len(verbs) == 0 {
+			return fmt.Errorf("no verbs to evaluate for resource %q, set --verb or list its verbs in the discovery file", resource.resource)
+		}
+
+		namespaces := c.namespaces
+		if !resource.namespaced {
+			namespaces = []string{""}
+		}
+
+		for _, verb := range verbs {
+			for _, namespace := range namespaces {
+				for _, name := range c.names {
+					attrs := kauthorizer.AttributesRecord{
+						Verb:            verb,
+						Namespace:       namespace,
+						APIGroup:        resource.group,
+						APIVersion:      resource.version,
+						Resource:        resource.resource,
+						Subresource:     resource.subresource,
+						Name:            name,
+						ResourceRequest: true,
+					}
+
+					decision, reason, err := authz.EvaluateToken(c.context(), c.token, attrs)
+					if err != nil {
+						return err
+					}
+
+					results = append(results, canIResult{
+						Verb:        verb,
+						APIGroup:    resource.group,
+						Resource:    resource.resource,
+						Subresource: resource.subresource,
+						Namespace:   namespace,
+						Name:        name,
+						Result:      c.result(decision),
+						Reason:      reason,
+					})
+				}
+			}
+		}
+	}
+
+	switch c.output {
+	case "text":
+		printCanIResults(out, results)
+	case "json":
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshalling results: %w", err)
+		}
+		fmt.Fprintln(out, string(data))
+	case "yaml":
+		data, err := yaml.Marshal(results)
+		if err != nil {
+			return fmt.Errorf("marshalling results: %w", err)
+		}
+		fmt.Fprint(out, string(data))
+	default:
+		return fmt.Errorf("unknown output format %q, expected one of text, json or yaml", c.output)
+	}
+
+	return nil
+}
+
+// result describes a decision the way authorize prints it.
+func (c canI) result(decision kauthorizer.Decision) string {
+	switch {
+	case decision == kauthorizer.DecisionDeny:
+		return "forbidden"
+	case decision == kauthorizer.DecisionNoOpinion && c.grantMode:
+		return "no opinion"
+	default:
+		return "allowed"
+	}
+}
+
+// resourceList returns the resources set with --resource followed by
+// those listed in the discovery file.
+func (c canI) resourceList() ([]canIResource, error) {
+	resources := []canIResource{}
+
+	for _, resource := range c.resources {
+		resource, subresource, _ := strings.Cut(resource, "/")
+		groupResource := schema.ParseGroupResource(resource)
+		resources = append(resources, canIResource{
+			group:       groupResource.Group,
+			resource:    groupResource.Resource,
+			subresource: subresource,
+			namespaced:  true,
+		})
+	}
+
+	if c.discoveryFile == "" {
+		return resources, nil
+	}
+
+	data, err := os.ReadFile(c.discoveryFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading discovery file: %w", err)
+	}
+
+	lists := []metav1.APIResourceList{}
+	if err := yaml.Unmarshal(data, &lists); err != nil {
+		list := metav1.APIResourceList{}
+		if err := yaml.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("parsing discovery file: %w", err)
+		}
+		lists = append(lists, list)
+	}
+
+	for _, list := range lists {
+		groupVersion, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return nil, fmt.Errorf("parsing discovery file: %w", err)
+		}
+
+		for _, apiResource := range list.APIResources {
+			resource, subresource, _ := strings.Cut(apiResource.Name, "/")
+			resources = append(resources, canIResource{
+				group:       groupVersion.Group,
+				version:     groupVersion.Version,
+				resource:    resource,
+				subresource: subresource,
+				namespaced:  apiResource.Namespaced,
+				verbs:       apiResource.Verbs,
+			})
+		}
+	}
+
+	return resources, nil
+}
+
+func printCanIResults(out io.Writer, results []canIResult) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERB\tRESOURCE\tNAMESPACE\tNAME\tRESULT")
+
+	for _, result := range results {
+		resource := result.Resource
+		if result.APIGroup != "" {
+			resource += "." + result.APIGroup
+		}
+		if result.Subresource != "" {
+			resource += "/" + result.Subresource
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", result.Verb, resource, orNone(result.Namespace), orNone(result.Name), result.Result)
+	}
+
+	w.Flush()
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
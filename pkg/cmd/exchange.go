@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/everettraven/biscuit/pkg/exchange"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/spf13/cobra"
+)
+
+func NewExchangeCommand() *cobra.Command {
+	exchanger := exchanger{}
+	cmd := &cobra.Command{
+		Use: "exchange",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exchanger.Exchange(os.Stdout)
+		},
+	}
+
+	cmd.Flags().StringVar(&exchanger.idToken, "id-token", "", "sets the ID token to exchange")
+	cmd.Flags().StringVar(&exchanger.idTokenFile, "id-token-file", "", "sets a file holding the ID token to exchange")
+	cmd.Flags().StringVar(&exchanger.server, "server", "", "sets the URL of the webhook's /exchange endpoint. When empty, the token is exchanged locally, as the webhook would")
+	cmd.Flags().StringVar(&exchanger.privateKeyFile, "private-key-file", "biscuit-key.pem", "sets the private key signing the exchanged token when exchanging locally")
+	cmd.Flags().StringVar(&exchanger.oidc.Issuer, "oidc-issuer", "", "sets the issuer ID tokens must be issued by when exchanging locally")
+	cmd.Flags().StringVar(&exchanger.oidc.Audience, "oidc-audience", "", "sets the audience ID tokens must be issued for when exchanging locally")
+	cmd.Flags().StringVar(&exchanger.jwksFile, "oidc-jwks-file", "", "sets the JSON Web Key Set verifying ID tokens when exchanging locally")
+	cmd.Flags().StringVar(&exchanger.oidc.UsernameClaim, "oidc-username-claim", "sub", "sets the ID token claim mapped to the username when exchanging locally")
+	cmd.Flags().StringVar(&exchanger.oidc.GroupsClaim, "oidc-groups-claim", "groups", "sets the ID token claim mapped to the groups when exchanging locally")
+	cmd.Flags().StringVar(&exchanger.oidc.UsernamePrefix, "oidc-username-prefix", "", "sets the prefix prepended to the username when exchanging locally. Defaults to the issuer followed by '#', or no prefix when the username claim is email. '-' disables it")
+	cmd.Flags().StringVar(&exchanger.oidc.GroupsPrefix, "oidc-groups-prefix", "", "sets the prefix prepended to the groups when exchanging locally. Defaults to the issuer followed by '#'. '-' disables it")
+	cmd.Flags().DurationVar(&exchanger.oidc.TTL, "ttl", time.Hour, "sets the maximum lifetime of the exchanged token when exchanging locally")
+	cmd.Flags().StringVarP(&exchanger.output, "output", "o", "token", "sets the output format, one of token or json")
+
+	return cmd
+}
+
+type exchanger struct {
+	idToken        string
+	idTokenFile    string
+	server         string
+	privateKeyFile string
+	oidc           exchange.OIDCConfig
+	jwksFile       string
+	output         string
+}
+
+func (e exchanger) Exchange(out io.Writer) error {
+	idToken, err := e.readIDToken()
+	if err != nil {
+		return err
+	}
+
+	var result exchange.Result
+	if e.server != "" {
+		result, err = e.exchangeRemote(idToken)
+	} else {
+		result, err = e.exchangeLocal(idToken)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch e.output {
+	case "token":
+		fmt.Fprint(out, result.Token)
+	case "json":
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshalling result: %w", err)
+		}
+		fmt.Fprintln(out, string(data))
+	default:
+		return fmt.Errorf("unknown output format %q, expected one of token or json", e.output)
+	}
+
+	return nil
+}
+
+func (e exchanger) readIDToken() (string, error) {
+	switch {
+	case e.idToken != "" && e.idTokenFile != "":
+		return "", errors.New("--id-token and --id-token-file are mutually exclusive")
+	case e.idToken != "":
+		return e.idToken, nil
+	case e.idTokenFile != "":
+		data, err := os.ReadFile(e.idTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("reading ID token file: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	default:
+		return "", errors.New("one of --id-token or --id-token-file is required")
+	}
+}
+
+func (e exchanger) exchangeLocal(idToken string) (exchange.Result, error) {
+	key, err := keys.LoadPrivateKey(e.privateKeyFile)
+	if err != nil {
+		return exchange.Result{}, err
+	}
+
+	keySet, err := exchange.NewJWKSFile(e.jwksFile)
+	if err != nil {
+		return exchange.Result{}, err
+	}
+
+	oidc, err := exchange.NewOIDC(e.oidc, keySet, key)
+	if err != nil {
+		return exchange.Result{}, err
+	}
+
+	return oidc.Exchange(context.Background(), idToken)
+}
+
+func (e exchanger) exchangeRemote(idToken string) (exchange.Result, error) {
+	body, err := json.Marshal(exchange.Request{Token: idToken})
+	if err != nil {
+		return exchange.Result{}, fmt.Errorf("marshalling request: %w", err)
+	}
+
+	resp, err := http.Post(e.server, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return exchange.Result{}, fmt.Errorf("exchanging token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return exchange.Result{}, fmt.Errorf("reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		failure := struct {
+			Error string `json:"error"`
+		}{}
+		if json.Unmarshal(respBody, &failure) == nil && failure.Error != "" {
+			return exchange.Result{}, fmt.Errorf("exchanging token: %s", failure.Error)
+		}
+		return exchange.Result{}, fmt.Errorf("exchanging token: %s", resp.Status)
+	}
+
+	result := exchange.Result{}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return exchange.Result{}, fmt.Errorf("unmarshalling response: %w", err)
+	}
+
+	return result, nil
+}
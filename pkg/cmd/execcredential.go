@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/everettraven/biscuit/pkg/attenuation"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientauthenticationv1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func NewExecCredentialCommand() *cobra.Command {
+	execCredential := execCredential{}
+	cmd := &cobra.Command{
+		Use: "exec-credential",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return execCredential.Print(os.Stdout)
+		},
+	}
+
+	cmd.Flags().StringVar(&execCredential.tokenFile, "token-file", "", "sets the file holding the parent token to attenuate")
+	cmd.Flags().StringVar(&execCredential.profileFile, "profile-file", "", "sets the file defining the attenuation profiles")
+	cmd.Flags().StringVar(&execCredential.profile, "profile", "", "sets the attenuation profile to apply. When empty, the token is only restricted by its expiry")
+	cmd.Flags().DurationVar(&execCredential.ttl, "ttl", 5*time.Minute, "sets how long each minted token is valid for")
+	cmd.Flags().DurationVar(&execCredential.refreshBefore, "refresh-before", 30*time.Second, "sets how long before its expiry a cached token is replaced")
+	cmd.Flags().StringVar(&execCredential.cacheDir, "cache-dir", "", "sets the directory minted tokens are cached in. Defaults to k8s-biscuit/exec-credential in the user cache directory")
+
+	return cmd
+}
+
+type execCredential struct {
+	tokenFile     string
+	profileFile   string
+	profile       string
+	ttl           time.Duration
+	refreshBefore time.Duration
+	cacheDir      string
+}
+
+type profileFile struct {
+	Profiles map[string]attenuation.Spec `json:"profiles"`
+}
+
+// cachedCredential is a minted token cached until shortly before it
+// expires.
+type cachedCredential struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Print prints an ExecCredential holding a token attenuated from the
+// parent token with the profile, reusing a cached token while it is not
+// about to expire.
+func (e execCredential) Print(out io.Writer) error {
+	if e.tokenFile == "" {
+		return errors.New("--token-file is required")
+	}
+
+	if e.ttl <= e.refreshBefore {
+		return errors.New("--ttl must be longer than --refresh-before")
+	}
+
+	parent, err := os.ReadFile(e.tokenFile)
+	if err != nil {
+		return fmt.Errorf("reading token file: %w", err)
+	}
+
+	p, err := e.loadProfile()
+	if err != nil {
+		return err
+	}
+
+	cachePath, err := e.cachePath(strings.TrimSpace(string(parent)), p)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	credential, ok := readCachedCredential(cachePath)
+	if !ok || credential.ExpiresAt.Sub(now) <= e.refreshBefore {
+		credential, err = e.mint(strings.TrimSpace(string(parent)), p, now)
+		if err != nil {
+			return err
+		}
+
+		if err := writeCachedCredential(cachePath, credential); err != nil {
+			return err
+		}
+	}
+
+	expiresAt := metav1.NewTime(credential.ExpiresAt)
+	data, err := json.Marshal(clientauthenticationv1.ExecCredential{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: clientauthenticationv1.SchemeGroupVersion.String(),
+			Kind:       "ExecCredential",
+		},
+		Status: &clientauthenticationv1.ExecCredentialStatus{
+			Token:               credential.Token,
+			ExpirationTimestamp: &expiresAt,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("marshalling exec credential: %w", err)
+	}
+
+	fmt.Fprintln(out, string(data))
+
+	return nil
+}
+
+func (e execCredential) loadProfile() (attenuation.Spec, error) {
+	if e.profile == "" {
+		return attenuation.Spec{}, nil
+	}
+
+	if e.profileFile == "" {
+		return attenuation.Spec{}, errors.New("--profile-file is required to use a profile")
+	}
+
+	data, err := os.ReadFile(e.profileFile)
+	if err != nil {
+		return attenuation.Spec{}, fmt.Errorf("reading profile file: %w", err)
+	}
+
+	profiles := profileFile{}
+	if err := yaml.UnmarshalStrict(data, &profiles); err != nil {
+		return attenuation.Spec{}, fmt.Errorf("parsing profile file: %w", err)
+	}
+
+	p, ok := profiles.Profiles[e.profile]
+	if !ok {
+		return attenuation.Spec{}, fmt.Errorf("profile %q not found in %s", e.profile, e.profileFile)
+	}
+
+	if p.TTL != nil || p.ExpiresAt != nil || p.NotBefore != nil {
+		return attenuation.Spec{}, fmt.Errorf("profile %q sets its own lifetime, which is set by --ttl", e.profile)
+	}
+
+	return p, nil
+}
+
+// mint attenuates the parent token with the profile and an expiry of
+// ttl from now, truncated to the second.
+func (e execCredential) mint(parent string, p attenuation.Spec, now time.Time) (cachedCredential, error) {
+	// Expiry checks hold RFC3339 times, without fractional seconds, so
+	// the expiry is truncated to the second and the same time is both
+	// checked and reported.
+	expiresAt := now.Add(e.ttl).Truncate(time.Second)
+
+	attenuator := attenuator{
+		token:    parent,
+		spec:     p,
+		validity: validity{expiresAt: expiresAt.Format(time.RFC3339)},
+	}
+
+	attenuated, err := attenuator.Attenuate()
+	if err != nil {
+		return cachedCredential{}, err
+	}
+
+	return cachedCredential{
+		Token:     base64.URLEncoding.EncodeToString(attenuated),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// cachePath returns the file caching tokens minted from the parent
+// token with the profile. Its name is a digest of both, so that changes
+// to either mint a new token.
+func (e execCredential) cachePath(parent string, p attenuation.Spec) (string, error) {
+	dir := e.cacheDir
+	if dir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("finding cache directory: %w", err)
+		}
+		dir = filepath.Join(userCacheDir, "k8s-biscuit", "exec-credential")
+	}
+
+	profileBytes, err := json.Marshal(p)
+	if err != nil {
+		return "", fmt.Errorf("marshalling profile: %w", err)
+	}
+
+	digest := sha256.New()
+	digest.Write([]byte(parent))
+	digest.Write([]byte{0})
+	digest.Write(profileBytes)
+	digest.Write([]byte{0})
+	digest.Write([]byte(e.ttl.String()))
+
+	return filepath.Join(dir, hex.EncodeToString(digest.Sum(nil))+".json"), nil
+}
+
+func readCachedCredential(path string) (cachedCredential, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cachedCredential{}, false
+	}
+
+	credential := cachedCredential{}
+	if err := json.Unmarshal(data, &credential); err != nil || credential.Token == "" {
+		return cachedCredential{}, false
+	}
+
+	return credential, true
+}
+
+// writeCachedCredential writes the credential readable only by the
+// user, replacing the cached file atomically so that concurrent
+// invocations never read a partial file.
+func writeCachedCredential(path string, credential cachedCredential) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("creating cache directory: %w", err)
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return fmt.Errorf("marshalling cached token: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("caching token: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("caching token: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("caching token: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("caching token: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	localauthorizer "github.com/everettraven/biscuit/pkg/authorizer"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+func NewExplainCommand() *cobra.Command {
+	explainer := explainer{}
+	cmd := &cobra.Command{
+		Use: "explain",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return explainer.Explain(os.Stdout)
+		},
+	}
+
+	explainer.AddFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&explainer.output, "output", "o", "text", "sets the output format, one of text, json or yaml")
+	cmd.Flags().BoolVar(&explainer.world, "world", false, "prints the Datalog world the token was evaluated in")
+
+	return cmd
+}
+
+type explainer struct {
+	authorizer
+	output string
+	world  bool
+}
+
+func (e explainer) Explain(out io.Writer) error {
+	attrs, err := e.attributes()
+	if err != nil {
+		return err
+	}
+
+	authz, err := e.newBiscuit()
+	if err != nil {
+		return err
+	}
+
+	explanation, err := authz.ExplainToken(e.context(), e.token, attrs)
+	if err != nil {
+		return err
+	}
+
+	if !e.world {
+		explanation.World = ""
+	}
+
+	switch e.output {
+	case "text":
+		printExplanation(out, explanation)
+	case "json":
+		data, err := json.MarshalIndent(explanation, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshalling explanation: %w", err)
+		}
+		fmt.Fprintln(out, string(data))
+	case "yaml":
+		data, err := yaml.Marshal(explanation)
+		if err != nil {
+			return fmt.Errorf("marshalling explanation: %w", err)
+		}
+		fmt.Fprint(out, string(data))
+	default:
+		return fmt.Errorf("unknown output format %q, expected one of text, json or yaml", e.output)
+	}
+
+	return nil
+}
+
+func printExplanation(out io.Writer, explanation *localauthorizer.Explanation) {
+	fmt.Fprintf(out, "Decision: %s\n", explanation.Decision)
+	if explanation.Reason != "" {
+		fmt.Fprintf(out, "Reason:   %s\n", explanation.Reason)
+	}
+
+	fmt.Fprintln(out, "\nRequest facts:")
+	for _, fact := range explanation.RequestFacts {
+		fmt.Fprintf(out, "  %s\n", fact)
+	}
+
+	if len(explanation.Checks) > 0 {
+		fmt.Fprintln(out, "\nChecks:")
+		for _, check := range explanation.Checks {
+			result := "pass"
+			if !check.Passed {
+				result = "FAIL"
+			}
+			fmt.Fprintf(out, "  %s  %s check #%d: %s\n", result, check.Origin, check.Index, check.Check)
+		}
+	}
+
+	if len(explanation.Policies) > 0 {
+		fmt.Fprintln(out, "\nPolicies:")
+		for _, policy := range explanation.Policies {
+			marker := " "
+			if policy.Matched {
+				marker = "*"
+			}
+			fmt.Fprintf(out, "  %s %s\n", marker, policy.Policy)
+		}
+	}
+
+	if explanation.World != "" {
+		fmt.Fprintf(out, "\nWorld:\n%s\n", explanation.World)
+	}
+}
@@ -4,15 +4,21 @@ import (
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/x509"
+	"encoding/binary"
 	"encoding/pem"
 	"fmt"
 	"os"
+	"strconv"
 
+	"github.com/everettraven/biscuit/pkg/keys"
 	"github.com/spf13/cobra"
 )
 
 func NewGenKeyCommand() *cobra.Command {
-	return &cobra.Command{
+	var name string
+	var keyID uint32
+
+	cmd := &cobra.Command{
 		Use: "genkey",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			rng := rand.Reader
@@ -21,27 +27,58 @@ func NewGenKeyCommand() *cobra.Command {
 				return fmt.Errorf("generating ed25519 keys: %w", err)
 			}
 
+			if !cmd.Flags().Changed("key-id") {
+				var id [4]byte
+				if _, err := rand.Read(id[:]); err != nil {
+					return fmt.Errorf("generating key ID: %w", err)
+				}
+				keyID = binary.BigEndian.Uint32(id[:])
+			}
+
+			headers := map[string]string{
+				keys.KeyIDHeader: strconv.FormatUint(uint64(keyID), 10),
+			}
+
 			privBytes, err := x509.MarshalPKCS8PrivateKey(privateRoot)
 			if err != nil {
 				return fmt.Errorf("marshalling private key: %w", err)
 			}
 
 			privPem := pem.EncodeToMemory(&pem.Block{
-				Type: "PRIVATE KEY",
-				Bytes: privBytes,
+				Type:    "PRIVATE KEY",
+				Headers: headers,
+				Bytes:   privBytes,
 			})
 
-			err = os.WriteFile("biscuit-key.pem", privPem, 0600)
+			pubBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+			if err != nil {
+				return fmt.Errorf("marshalling public key: %w", err)
+			}
+
+			pubPem := pem.EncodeToMemory(&pem.Block{
+				Type:    "PUBLIC KEY",
+				Headers: headers,
+				Bytes:   pubBytes,
+			})
+
+			err = os.WriteFile(name+".pem", privPem, 0600)
 			if err != nil {
 				return fmt.Errorf("writing private key to file: %w", err)
 			}
 
-			err = os.WriteFile("biscuit-key.pub", publicKey, 0644)
+			err = os.WriteFile(name+".pub", pubPem, 0644)
 			if err != nil {
 				return fmt.Errorf("writing public key to file: %w", err)
 			}
 
+			fmt.Printf("generated key %d\n", keyID)
+
 			return nil
 		},
 	}
+
+	cmd.Flags().StringVar(&name, "name", "biscuit-key", "sets the name of the generated key files, written to NAME.pem and NAME.pub")
+	cmd.Flags().Uint32Var(&keyID, "key-id", 0, "sets the key ID stamped into the tokens signed by the key. A random ID is used if unset")
+
+	return cmd
 }
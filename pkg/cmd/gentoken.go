@@ -1,17 +1,13 @@
 package cmd
 
 import (
-	"crypto/ed25519"
-	"crypto/x509"
-	"encoding/base64"
-	"encoding/pem"
-	"errors"
 	"fmt"
-	"os"
 	"strings"
+	"time"
 
-	"github.com/biscuit-auth/biscuit-go/v2"
-	"github.com/biscuit-auth/biscuit-go/v2/parser"
+	"github.com/everettraven/biscuit/pkg/identitypolicy"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/everettraven/biscuit/pkg/mint"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
@@ -37,64 +33,85 @@ func NewGenTokenCommand() *cobra.Command {
 }
 
 type TokenGenerator struct {
-	username string
-	groups   []string
-	keyFile  string
+	username  string
+	uid       string
+	groups    []string
+	extra     []string
+	keyFile   string
+	grants    []string
+	audiences []string
+	validity  validity
+
+	identityPolicy string
 }
 
 func (tg *TokenGenerator) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&tg.username, "username", "jane", "set the username to set in the token")
+	fs.StringVar(&tg.uid, "uid", "", "set the UID to set in the token")
 	fs.StringArrayVar(&tg.groups, "groups", []string{}, "set the groups to set in the token")
+	fs.StringArrayVar(&tg.extra, "extra", []string{}, "add an extra attribute to set in the token, in the form KEY=VALUE. May be repeated, including for the same key")
 	fs.StringVar(&tg.keyFile, "private-key-file", "biscuit-key.pem", "set the private key file to use for generating the token")
+	fs.StringArrayVar(&tg.grants, "grant", []string{}, "add a grant, in the form RESOURCE[.GROUP][/SUBRESOURCE]:VERB[:NAMESPACE], used by the webhook in grant mode. '*' matches any value, an omitted group matches the core group, an omitted subresource matches the main resource only, an omitted namespace matches any namespace and an empty namespace matches cluster-scoped requests")
+	fs.StringArrayVar(&tg.audiences, "audience", []string{}, "restricts the token to TokenReviews for this audience. May be repeated to allow any of several audiences")
+	fs.StringVar(&tg.identityPolicy, "identity-policy-file", "", "set an identity policy file the token's username and groups are checked against, as the webhook does, before minting")
+	tg.validity.AddFlags(fs)
 }
 
 func (tg *TokenGenerator) Generate() (string, error) {
-	bytes, err := os.ReadFile(tg.keyFile)
+	key, err := keys.LoadPrivateKey(tg.keyFile)
 	if err != nil {
-		return "", fmt.Errorf("reading private key from file: %w", err)
+		return "", err
 	}
 
-	block, _ := pem.Decode(bytes)
-
-	privKeyInterface, err := x509.ParsePKCS8PrivateKey(block.Bytes)
-	if err != nil {
-		return "", fmt.Errorf("parsing private key: %w", err)
-	}
-
-	privKey, ok := privKeyInterface.(ed25519.PrivateKey)
-	if !ok {
-		return "", errors.New("biscuit token generation requires a ed25519 private key")
+	// The authenticator splits groups on commas, so reject them before the
+	// identity policy is checked against groups it would not see.
+	if err := mint.ValidateIdentity(tg.username, tg.groups); err != nil {
+		return "", err
 	}
 
-	builder := biscuit.NewBuilder(privKey)
-
-	var authorityBlock strings.Builder
-
-	authorityBlock.WriteString(fmt.Sprintf("k8s:userinfo:username(%q);\n", tg.username))
+	if tg.identityPolicy != "" {
+		policy, err := identitypolicy.NewFile(tg.identityPolicy)
+		if err != nil {
+			return "", err
+		}
 
-	for _, group := range tg.groups {
-		authorityBlock.WriteString(fmt.Sprintf("k8s:userinfo:group(%q);\n", group))
+		if err := policy.Current().Check(key.ID, key.HasID, tg.username, tg.groups); err != nil {
+			return "", err
+		}
 	}
 
-	authority, err := parser.FromStringBlock(authorityBlock.String())
-	if err != nil {
-		return "", fmt.Errorf("parsing authority block: %w", err)
+	token := mint.Token{
+		Username:  tg.username,
+		UID:       tg.uid,
+		Groups:    tg.groups,
+		Audiences: tg.audiences,
 	}
 
-	err = builder.AddBlock(authority)
-	if err != nil {
-		return "", fmt.Errorf("adding authority block: %w", err)
+	for _, extra := range tg.extra {
+		key, value, ok := strings.Cut(extra, "=")
+		if !ok {
+			return "", fmt.Errorf("invalid extra %q: expected KEY=VALUE", extra)
+		}
+
+		if token.Extra == nil {
+			token.Extra = map[string][]string{}
+		}
+		token.Extra[key] = append(token.Extra[key], value)
 	}
 
-	b, err := builder.Build()
-	if err != nil {
-		return "", fmt.Errorf("failed to build biscuit: %v", err)
+	for _, grantString := range tg.grants {
+		grant, err := mint.ParseGrant(grantString)
+		if err != nil {
+			return "", err
+		}
+
+		token.Grants = append(token.Grants, grant)
 	}
 
-	token, err := b.Serialize()
+	token.Checks, err = tg.validity.Checks(time.Now())
 	if err != nil {
-		return "", fmt.Errorf("failed to serialize biscuit: %v", err)
+		return "", err
 	}
 
-	return base64.URLEncoding.EncodeToString(token), nil
+	return token.Mint(key)
 }
@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/everettraven/biscuit/pkg/authenticator"
+	"github.com/everettraven/biscuit/pkg/identitypolicy"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/everettraven/biscuit/pkg/tokenutil"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+func NewInspectCommand() *cobra.Command {
+	inspector := inspector{}
+	cmd := &cobra.Command{
+		Use: "inspect",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return inspector.Inspect(os.Stdout)
+		},
+	}
+
+	cmd.Flags().StringVar(&inspector.token, "token", "", "sets token to inspect")
+	cmd.Flags().StringArrayVar(&inspector.pubKeyFiles, "public-key-file", []string{}, "sets public key files, or directories of *.pub files, to verify the token with and report the fingerprint of the verifying key")
+	cmd.Flags().StringVar(&inspector.prefixes.Username, "username-prefix", "", "sets the prefix the webhook prepends to usernames, applied to the identity reported for verified tokens")
+	cmd.Flags().StringVar(&inspector.prefixes.Group, "group-prefix", "", "sets the prefix the webhook prepends to groups, applied to the identity reported for verified tokens")
+	cmd.Flags().StringVarP(&inspector.output, "output", "o", "text", "sets the output format, one of text, json, yaml or datalog")
+
+	return cmd
+}
+
+type inspector struct {
+	token       string
+	pubKeyFiles []string
+	prefixes    identitypolicy.Prefixes
+	output      string
+}
+
+type tokenInfo struct {
+	Size               int               `json:"size"`
+	RootKeyID          *uint32           `json:"rootKeyID,omitempty"`
+	RootKeyFingerprint string            `json:"rootKeyFingerprint,omitempty"`
+	VerificationError  string            `json:"verificationError,omitempty"`
+	Sealed             bool              `json:"sealed"`
+	Identity           *identity         `json:"identity,omitempty"`
+	Blocks             []tokenutil.Block `json:"blocks"`
+}
+
+// identity is the identity the webhook authenticates a verified token
+// as, with its prefixes applied.
+type identity struct {
+	Username string              `json:"username"`
+	UID      string              `json:"uid,omitempty"`
+	Groups   []string            `json:"groups,omitempty"`
+	Extra    map[string][]string `json:"extra,omitempty"`
+}
+
+func (i inspector) Inspect(out io.Writer) error {
+	decodedToken, err := base64.URLEncoding.DecodeString(i.token)
+	if err != nil {
+		return fmt.Errorf("decoding token: %w", err)
+	}
+
+	token, err := biscuit.Unmarshal(decodedToken)
+	if err != nil {
+		return fmt.Errorf("unmarshalling token: %w", err)
+	}
+
+	blocks, err := tokenutil.Blocks(token)
+	if err != nil {
+		return fmt.Errorf("reading token blocks: %w", err)
+	}
+
+	info := tokenInfo{
+		Size:   len(decodedToken),
+		Sealed: tokenutil.Sealed(token),
+		Blocks: blocks,
+	}
+
+	if id, ok := keys.RootKeyID(decodedToken); ok {
+		info.RootKeyID = &id
+	}
+
+	if len(i.pubKeyFiles) > 0 {
+		publicKeys, err := keys.Load(i.pubKeyFiles)
+		if err != nil {
+			return fmt.Errorf("loading public keys: %w", err)
+		}
+
+		now := time.Now()
+		key, authz, err := publicKeys.VerifiedAuthorizer(token, now)
+		if err != nil {
+			info.VerificationError = err.Error()
+		} else {
+			info.RootKeyFingerprint = key.Fingerprint()
+
+			for _, fact := range tokenutil.TimeFacts(now, 0) {
+				authz.AddFact(fact)
+			}
+
+			tokenIdentity, err := authenticator.TokenIdentity(authz)
+			if err != nil {
+				return fmt.Errorf("reading token identity: %w", err)
+			}
+
+			prefixed := i.prefixes.Apply(tokenIdentity)
+			info.Identity = &identity{
+				Username: prefixed.GetName(),
+				UID:      prefixed.GetUID(),
+				Groups:   prefixed.GetGroups(),
+				Extra:    prefixed.GetExtra(),
+			}
+		}
+	}
+
+	switch i.output {
+	case "text":
+		printTokenInfo(out, info, i.pubKeyFiles)
+	case "json":
+		data, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshalling token info: %w", err)
+		}
+		fmt.Fprintln(out, string(data))
+	case "yaml":
+		data, err := yaml.Marshal(info)
+		if err != nil {
+			return fmt.Errorf("marshalling token info: %w", err)
+		}
+		fmt.Fprint(out, string(data))
+	case "datalog":
+		printTokenDatalog(out, info)
+	default:
+		return fmt.Errorf("unknown output format %q, expected one of text, json, yaml or datalog", i.output)
+	}
+
+	return nil
+}
+
+func printTokenInfo(out io.Writer, info tokenInfo, pubKeyFiles []string) {
+	fmt.Fprintf(out, "Size:     %d bytes\n", info.Size)
+
+	if info.RootKeyID != nil {
+		fmt.Fprintf(out, "Key ID:   %d\n", *info.RootKeyID)
+	} else {
+		fmt.Fprintln(out, "Key ID:   none")
+	}
+
+	switch {
+	case len(pubKeyFiles) == 0:
+		fmt.Fprintln(out, "Root key: not verified, set --public-key-file to verify")
+	case info.VerificationError != "":
+		fmt.Fprintf(out, "Root key: verification failed: %s\n", info.VerificationError)
+	default:
+		fmt.Fprintf(out, "Root key: %s\n", info.RootKeyFingerprint)
+	}
+
+	fmt.Fprintf(out, "Sealed:   %t\n", info.Sealed)
+
+	if info.Identity != nil {
+		fmt.Fprintf(out, "User:     %s\n", info.Identity.Username)
+		if info.Identity.UID != "" {
+			fmt.Fprintf(out, "UID:      %s\n", info.Identity.UID)
+		}
+		if len(info.Identity.Groups) > 0 {
+			fmt.Fprintf(out, "Groups:   %s\n", strings.Join(info.Identity.Groups, ", "))
+		}
+		for _, key := range slices.Sorted(maps.Keys(info.Identity.Extra)) {
+			fmt.Fprintf(out, "Extra:    %s=%s\n", key, strings.Join(info.Identity.Extra[key], ","))
+		}
+	}
+
+	for n, block := range info.Blocks {
+		fmt.Fprintf(out, "\n%s\n", blockName(n))
+		fmt.Fprintf(out, "  Revocation ID: %s\n", block.RevocationID)
+		if block.Context != "" {
+			fmt.Fprintf(out, "  Context:       %s\n", block.Context)
+		}
+
+		for _, section := range []struct {
+			name  string
+			lines []string
+		}{
+			{name: "Facts", lines: block.Facts},
+			{name: "Rules", lines: block.Rules},
+			{name: "Checks", lines: block.Checks},
+		} {
+			if len(section.lines) == 0 {
+				continue
+			}
+
+			fmt.Fprintf(out, "  %s:\n", section.name)
+			for _, line := range section.lines {
+				fmt.Fprintf(out, "    %s\n", line)
+			}
+		}
+	}
+}
+
+func printTokenDatalog(out io.Writer, info tokenInfo) {
+	for n, block := range info.Blocks {
+		if n > 0 {
+			fmt.Fprintln(out)
+		}
+
+		fmt.Fprintf(out, "// %s\n", blockName(n))
+		if block.Context != "" {
+			fmt.Fprintf(out, "// context: %s\n", block.Context)
+		}
+
+		for _, lines := range [][]string{block.Facts, block.Rules, block.Checks} {
+			for _, line := range lines {
+				fmt.Fprintf(out, "%s;\n", strings.TrimSpace(line))
+			}
+		}
+	}
+}
+
+func blockName(n int) string {
+	if n == 0 {
+		return "Block #0 (authority)"
+	}
+	return fmt.Sprintf("Block #%d", n)
+}
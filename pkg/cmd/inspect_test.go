@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/biscuit-auth/biscuit-go/v2/parser"
+)
+
+func TestInspectDatalogRoundTrip(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	authority := `k8s:userinfo:username("jane");
+k8s:userinfo:groups("one,two");
+team("payments");
+member($user) <- k8s:userinfo:username($user), team("payments");
+check if k8s:namespace($namespace), ["default", "payments"].contains($namespace);
+`
+	attenuation := `check if k8s:verb("get") or k8s:verb("list");
+check if k8s:resource($resource), ["deployments", "pods"].contains($resource);
+`
+
+	authorityBlock, err := parser.FromStringBlock(authority)
+	if err != nil {
+		t.Fatalf("parsing authority block: %v", err)
+	}
+
+	builder := biscuit.NewBuilder(private)
+	if err := builder.AddBlock(authorityBlock); err != nil {
+		t.Fatalf("adding authority block: %v", err)
+	}
+
+	token, err := builder.Build()
+	if err != nil {
+		t.Fatalf("building token: %v", err)
+	}
+
+	attenuationBlock, err := parser.FromStringBlock(attenuation)
+	if err != nil {
+		t.Fatalf("parsing attenuation block: %v", err)
+	}
+
+	blockBuilder := token.CreateBlock()
+	if err := blockBuilder.AddBlock(attenuationBlock); err != nil {
+		t.Fatalf("adding attenuation block: %v", err)
+	}
+
+	token, err = token.Append(rand.Reader, blockBuilder.Build())
+	if err != nil {
+		t.Fatalf("appending block: %v", err)
+	}
+
+	serialized, err := token.Serialize()
+	if err != nil {
+		t.Fatalf("serializing token: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	if err := (inspector{token: base64.URLEncoding.EncodeToString(serialized), output: "datalog"}).Inspect(out); err != nil {
+		t.Fatalf("inspecting token: %v", err)
+	}
+
+	want := "// Block #0 (authority)\n" + authority + "\n// Block #1\n" + attenuation
+	if got := sortSets(out.String()); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, block := range strings.Split(out.String(), "\n\n") {
+		if _, err := parser.FromStringBlock(block); err != nil {
+			t.Errorf("parsing inspected block: %v\n%s", err, block)
+		}
+	}
+}
+
+var setPattern = regexp.MustCompile(`\[[^\]]*\]`)
+
+// sortSets sorts the elements of the sets in source, which biscuit-go
+// prints in no particular order.
+func sortSets(source string) string {
+	return setPattern.ReplaceAllStringFunc(source, func(set string) string {
+		elements := strings.Split(strings.Trim(set, "[]"), ", ")
+		slices.Sort(elements)
+		return "[" + strings.Join(elements, ", ") + "]"
+	})
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// NewKubectlPluginCommand returns the root command of the kubectl-biscuit
+// plugin, which works on the credentials in the kubeconfig.
+func NewKubectlPluginCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use: "kubectl-biscuit",
+	}
+
+	cmd.AddCommand(NewKubectlAttenuateCommand())
+
+	return cmd
+}
+
+func NewKubectlAttenuateCommand() *cobra.Command {
+	attenuator := kubeconfigAttenuator{
+		pathOptions: clientcmd.NewDefaultPathOptions(),
+	}
+	cmd := &cobra.Command{
+		Use: "attenuate",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return attenuator.Attenuate()
+		},
+	}
+
+	cmd.Flags().StringVar(&attenuator.pathOptions.LoadingRules.ExplicitPath, "kubeconfig", "", "sets the kubeconfig file to read the token from and write the attenuated credential to")
+	cmd.Flags().StringVar(&attenuator.context, "context", "", "sets the context whose user's token is attenuated. Defaults to the current context")
+	cmd.Flags().StringVar(&attenuator.newContext, "new-context", "", "sets the name of the context and user written for the attenuated token. Defaults to the context's name suffixed with -attenuated")
+	cmd.Flags().BoolVar(&attenuator.namespaceFromContext, "namespace-from-context", false, "restricts the token to the context's namespace when no --namespace is set")
+	cmd.Flags().BoolVar(&attenuator.use, "use", false, "switches the current context to the new context")
+	cmd.Flags().BoolVar(&attenuator.overwrite, "overwrite", false, "replaces the context and user named by --new-context if they already exist")
+	attenuator.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+type kubeconfigAttenuator struct {
+	attenuator
+	pathOptions          *clientcmd.PathOptions
+	context              string
+	newContext           string
+	namespaceFromContext bool
+	use                  bool
+	overwrite            bool
+}
+
+// Attenuate attenuates the token of the context's user and adds a user
+// holding the attenuated token and a context using it to the kubeconfig,
+// leaving the original user and context as they are.
+func (k kubeconfigAttenuator) Attenuate() error {
+	config, err := k.pathOptions.GetStartingConfig()
+	if err != nil {
+		return fmt.Errorf("loading kubeconfig: %w", err)
+	}
+
+	contextName := k.context
+	if contextName == "" {
+		contextName = config.CurrentContext
+	}
+
+	context, ok := config.Contexts[contextName]
+	if !ok {
+		return fmt.Errorf("context %q not found in kubeconfig", contextName)
+	}
+
+	authInfo, ok := config.AuthInfos[context.AuthInfo]
+	if !ok {
+		return fmt.Errorf("user %q of context %q not found in kubeconfig", context.AuthInfo, contextName)
+	}
+
+	k.token, err = authInfoToken(authInfo)
+	if err != nil {
+		return fmt.Errorf("reading token of user %q: %w", context.AuthInfo, err)
+	}
+
+	newContextName := k.newContext
+	if newContextName == "" {
+		newContextName = contextName + "-attenuated"
+	}
+
+	if newContextName == contextName || newContextName == context.AuthInfo {
+		return fmt.Errorf("new context %q would overwrite the original context or user", newContextName)
+	}
+
+	_, contextExists := config.Contexts[newContextName]
+	_, authInfoExists := config.AuthInfos[newContextName]
+	if (contextExists || authInfoExists) && !k.overwrite {
+		return fmt.Errorf("context or user %q already exists in kubeconfig, set --overwrite to replace it", newContextName)
+	}
+
+	if k.namespaceFromContext && len(k.spec.Namespaces) == 0 && context.Namespace != "" {
+		k.spec.Namespaces = []string{context.Namespace}
+	}
+
+	attenuated, err := k.attenuator.Attenuate()
+	if err != nil {
+		return err
+	}
+
+	newAuthInfo := clientcmdapi.NewAuthInfo()
+	newAuthInfo.Token = base64.URLEncoding.EncodeToString(attenuated)
+	config.AuthInfos[newContextName] = newAuthInfo
+
+	newContext := context.DeepCopy()
+	newContext.AuthInfo = newContextName
+	config.Contexts[newContextName] = newContext
+
+	if k.use {
+		config.CurrentContext = newContextName
+	}
+
+	if err := clientcmd.ModifyConfig(k.pathOptions, *config, true); err != nil {
+		return fmt.Errorf("writing kubeconfig: %w", err)
+	}
+
+	fmt.Printf("context %q written with a token attenuated from user %q\n", newContextName, context.AuthInfo)
+
+	return nil
+}
+
+// authInfoToken returns the bearer token of the kubeconfig user, set
+// either inline or in a token file.
+func authInfoToken(authInfo *clientcmdapi.AuthInfo) (string, error) {
+	if authInfo.Token != "" {
+		return authInfo.Token, nil
+	}
+
+	if authInfo.TokenFile != "" {
+		token, err := os.ReadFile(authInfo.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("reading token file: %w", err)
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+
+	return "", fmt.Errorf("user has no token or token file")
+}
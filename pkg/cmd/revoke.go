@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/spf13/cobra"
+)
+
+func NewRevokeCommand() *cobra.Command {
+	revoker := revoker{}
+	cmd := &cobra.Command{
+		Use: "revoke",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return revoker.Revoke()
+		},
+	}
+
+	cmd.Flags().StringVar(&revoker.token, "token", "", "sets the token to revoke")
+	cmd.Flags().IntVar(&revoker.block, "block", -1, "sets the index of the block to revoke, 0 being the authority block. Revoking a block revokes every token derived from it. Defaults to the last block, revoking only the given token and the tokens attenuated from it")
+	cmd.Flags().StringVar(&revoker.revocationList, "revocation-list", "revocation-list", "sets the revocation list file the revocation ID is appended to")
+	cmd.Flags().StringVar(&revoker.reason, "reason", "", "sets a comment recorded alongside the revocation ID")
+
+	return cmd
+}
+
+type revoker struct {
+	token          string
+	block          int
+	revocationList string
+	reason         string
+}
+
+func (r revoker) Revoke() error {
+	decodedToken, err := base64.URLEncoding.DecodeString(r.token)
+	if err != nil {
+		return fmt.Errorf("decoding token: %w", err)
+	}
+
+	token, err := biscuit.Unmarshal(decodedToken)
+	if err != nil {
+		return fmt.Errorf("unmarshalling token: %w", err)
+	}
+
+	ids := token.RevocationIds()
+
+	block := r.block
+	if block < 0 {
+		block = len(ids) - 1
+	}
+
+	if block >= len(ids) {
+		return fmt.Errorf("token has %d blocks, cannot revoke block #%d", len(ids), block)
+	}
+
+	id := hex.EncodeToString(ids[block])
+
+	entry := fmt.Sprintf("# revoked block #%d at %s", block, time.Now().UTC().Format(time.RFC3339))
+	if r.reason != "" {
+		entry += ": " + r.reason
+	}
+	entry += "\n" + id + "\n"
+
+	f, err := os.OpenFile(r.revocationList, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("opening revocation list: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(entry); err != nil {
+		return fmt.Errorf("writing revocation list: %w", err)
+	}
+
+	fmt.Println(id)
+
+	return nil
+}
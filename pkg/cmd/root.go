@@ -10,7 +10,14 @@ func NewRootCommand() *cobra.Command {
 	cmd.AddCommand(NewGenKeyCommand())
 	cmd.AddCommand(NewGenTokenCommand())
 	cmd.AddCommand(NewAttenuateCommand())
+	cmd.AddCommand(NewSealCommand())
+	cmd.AddCommand(NewExchangeCommand())
+	cmd.AddCommand(NewExecCredentialCommand())
 	cmd.AddCommand(NewAuthorizeCommand())
+	cmd.AddCommand(NewExplainCommand())
+	cmd.AddCommand(NewCanICommand())
+	cmd.AddCommand(NewInspectCommand())
+	cmd.AddCommand(NewRevokeCommand())
 	cmd.AddCommand(NewRunCommand())
 
 	return cmd
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/everettraven/biscuit/pkg/attenuation"
+	"github.com/spf13/cobra"
+)
+
+func NewSealCommand() *cobra.Command {
+	var token string
+	cmd := &cobra.Command{
+		Use: "seal",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sealed, err := seal(token)
+			if err != nil {
+				return err
+			}
+
+			fmt.Print(base64.URLEncoding.EncodeToString(sealed))
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&token, "token", "", "sets token to seal. A sealed token can still be used, but no longer attenuated")
+
+	return cmd
+}
+
+func seal(token string) ([]byte, error) {
+	decodedToken, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("decoding token: %w", err)
+	}
+
+	b, err := biscuit.Unmarshal(decodedToken)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling token: %w", err)
+	}
+
+	sealed, err := b.Seal(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal: %v", err)
+	}
+
+	return attenuation.Serialize(sealed, decodedToken)
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/everettraven/biscuit/pkg/tokenutil"
+	"github.com/spf13/pflag"
+)
+
+// validity bounds the lifetime of a token through time checks.
+type validity struct {
+	ttl       time.Duration
+	expiresAt string
+	notBefore string
+}
+
+func (v *validity) AddFlags(fs *pflag.FlagSet) {
+	fs.DurationVar(&v.ttl, "ttl", 0, "sets how long the token is valid for, starting now")
+	fs.StringVar(&v.expiresAt, "expires-at", "", "sets the RFC3339 time after which the token is no longer valid")
+	fs.StringVar(&v.notBefore, "not-before", "", "sets the RFC3339 time before which the token is not yet valid")
+}
+
+func (v *validity) Checks(now time.Time) ([]biscuit.Check, error) {
+	expiresAt, notBefore, err := v.Times(now)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokenutil.ValidityChecks(expiresAt, notBefore)
+}
+
+// Times returns the expiry and not-before times set by the flags. A zero
+// time leaves that side unbounded.
+func (v *validity) Times(now time.Time) (time.Time, time.Time, error) {
+	if v.ttl != 0 && v.expiresAt != "" {
+		return time.Time{}, time.Time{}, errors.New("--ttl and --expires-at are mutually exclusive")
+	}
+
+	if v.ttl < 0 {
+		return time.Time{}, time.Time{}, errors.New("--ttl must be positive")
+	}
+
+	var expiresAt, notBefore time.Time
+	switch {
+	case v.ttl != 0:
+		expiresAt = now.Add(v.ttl)
+	case v.expiresAt != "":
+		t, err := time.Parse(time.RFC3339, v.expiresAt)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("parsing --expires-at: %w", err)
+		}
+		expiresAt = t
+	}
+
+	if v.notBefore != "" {
+		t, err := time.Parse(time.RFC3339, v.notBefore)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("parsing --not-before: %w", err)
+		}
+		notBefore = t
+	}
+
+	return expiresAt, notBefore, nil
+}
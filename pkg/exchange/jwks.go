@@ -0,0 +1,85 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/everettraven/biscuit/pkg/filewatch"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// JWKSFile holds a JSON Web Key Set trusted to verify ID tokens, such as
+// a copy of an identity provider's jwks_uri document.
+type JWKSFile struct {
+	path    string
+	loaded  []byte
+	current atomic.Pointer[jose.JSONWebKeySet]
+}
+
+// NewJWKSFile loads the key set at path.
+func NewJWKSFile(path string) (*JWKSFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading JWKS file: %w", err)
+	}
+
+	keySet, err := ParseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &JWKSFile{path: path, loaded: data}
+	f.current.Store(keySet)
+
+	return f, nil
+}
+
+// Watch reloads the key set whenever the file changes, until ctx is
+// cancelled. If the new key set fails to parse, the previous one is kept.
+func (f *JWKSFile) Watch(ctx context.Context, interval time.Duration) {
+	filewatch.Poll(ctx, f.path, interval, f.loaded, func(data []byte) {
+		keySet, err := ParseJWKS(data)
+		if err != nil {
+			log.Printf("keeping previous JWKS, new JWKS is invalid: %v\n", err)
+			return
+		}
+
+		f.current.Store(keySet)
+		log.Printf("reloaded JWKS file %s, %d keys\n", f.path, len(keySet.Keys))
+	})
+}
+
+// Current returns the most recently loaded valid key set.
+func (f *JWKSFile) Current() *jose.JSONWebKeySet {
+	return f.current.Load()
+}
+
+// ParseJWKS parses a JSON Web Key Set, rejecting sets without keys and
+// keys that are private or that carry no key ID.
+func ParseJWKS(data []byte) (*jose.JSONWebKeySet, error) {
+	keySet := &jose.JSONWebKeySet{}
+	if err := json.Unmarshal(data, keySet); err != nil {
+		return nil, fmt.Errorf("parsing JWKS: %w", err)
+	}
+
+	if len(keySet.Keys) == 0 {
+		return nil, fmt.Errorf("parsing JWKS: no keys found")
+	}
+
+	for _, key := range keySet.Keys {
+		if !key.IsPublic() {
+			return nil, fmt.Errorf("parsing JWKS: key %q is not a public key", key.KeyID)
+		}
+
+		if key.KeyID == "" {
+			return nil, fmt.Errorf("parsing JWKS: keys must have a key ID")
+		}
+	}
+
+	return keySet, nil
+}
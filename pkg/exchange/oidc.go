@@ -0,0 +1,242 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/everettraven/biscuit/pkg/identitypolicy"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/everettraven/biscuit/pkg/mint"
+	"github.com/everettraven/biscuit/pkg/tokenutil"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// Result is a biscuit token minted in exchange for another token.
+type Result struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Request is the body of a request to exchange a token.
+type Request struct {
+	Token string `json:"token"`
+}
+
+// OIDCConfig sets which ID tokens are accepted and how their claims map
+// to the identity of the minted token.
+type OIDCConfig struct {
+	Issuer   string
+	Audience string
+
+	// UsernameClaim is the claim holding the username. When it is
+	// "email", the email_verified claim must not be false.
+	UsernameClaim string
+
+	// GroupsClaim is the claim holding the groups, either a string or a
+	// list of strings. It may be absent from ID tokens.
+	GroupsClaim string
+
+	// UsernamePrefix and GroupsPrefix are prepended to the username and
+	// groups, keeping the identities of the issuer apart from those of
+	// the cluster, as kube-apiserver's OIDC authenticator does. Empty
+	// prefixes default to the issuer followed by "#", except for the
+	// username when UsernameClaim is "email". "-" disables a prefix.
+	UsernamePrefix string
+	GroupsPrefix   string
+
+	// TTL bounds the lifetime of minted tokens, which never outlive the
+	// ID token they were exchanged for.
+	TTL time.Duration
+
+	// ClockSkew is tolerated when validating the ID token's times.
+	ClockSkew time.Duration
+}
+
+// signatureAlgorithms are the algorithms accepted for ID token
+// signatures.
+var signatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.EdDSA,
+}
+
+// NewOIDC returns an exchanger minting biscuit tokens signed with key
+// for ID tokens issued by the configured issuer and verified by keySet.
+func NewOIDC(config OIDCConfig, keySet *JWKSFile, key keys.PrivateKey) (*OIDC, error) {
+	if config.Issuer == "" {
+		return nil, errors.New("an OIDC issuer is required")
+	}
+
+	if config.Audience == "" {
+		return nil, errors.New("an OIDC audience is required")
+	}
+
+	if config.UsernameClaim == "" {
+		return nil, errors.New("an OIDC username claim is required")
+	}
+
+	if config.TTL <= 0 {
+		return nil, errors.New("the TTL of exchanged tokens must be positive")
+	}
+
+	config.UsernamePrefix = claimPrefix(config.UsernamePrefix, config.Issuer, config.UsernameClaim != "email")
+	config.GroupsPrefix = claimPrefix(config.GroupsPrefix, config.Issuer, true)
+
+	return &OIDC{
+		config: config,
+		keySet: keySet,
+		key:    key,
+		now:    time.Now,
+	}, nil
+}
+
+type OIDC struct {
+	config OIDCConfig
+	keySet *JWKSFile
+	key    keys.PrivateKey
+	now    func() time.Time
+}
+
+// Exchange validates the ID token and mints a biscuit token for the
+// identity its claims map to.
+func (o *OIDC) Exchange(ctx context.Context, idToken string) (Result, error) {
+	parsed, err := jwt.ParseSigned(idToken, signatureAlgorithms)
+	if err != nil {
+		return Result{}, fmt.Errorf("parsing ID token: %w", err)
+	}
+
+	registered := jwt.Claims{}
+	claims := map[string]interface{}{}
+	if err := parsed.Claims(o.keySet.Current(), &registered, &claims); err != nil {
+		return Result{}, fmt.Errorf("verifying ID token: %w", err)
+	}
+
+	now := o.now()
+
+	expected := jwt.Expected{
+		Issuer:      o.config.Issuer,
+		AnyAudience: jwt.Audience{o.config.Audience},
+		Time:        now,
+	}
+	if err := registered.ValidateWithLeeway(expected, o.config.ClockSkew); err != nil {
+		return Result{}, fmt.Errorf("validating ID token: %w", err)
+	}
+
+	if registered.Expiry == nil {
+		return Result{}, errors.New("validating ID token: exp claim is required")
+	}
+
+	username, err := o.username(claims)
+	if err != nil {
+		return Result{}, err
+	}
+
+	groups, err := o.groups(claims)
+	if err != nil {
+		return Result{}, err
+	}
+
+	expiresAt := now.Add(o.config.TTL)
+	if idTokenExpiry := registered.Expiry.Time(); idTokenExpiry.Before(expiresAt) {
+		expiresAt = idTokenExpiry
+	}
+
+	return mintUntil(o.key, mint.Token{Username: username, Groups: groups}, expiresAt)
+}
+
+// claimPrefix resolves a configured prefix: "-" disables it and an empty
+// prefix defaults to the issuer followed by "#" if issuerDefault is set.
+func claimPrefix(prefix, issuer string, issuerDefault bool) string {
+	switch {
+	case prefix == "-":
+		return ""
+	case prefix == "" && issuerDefault:
+		return issuer + "#"
+	default:
+		return prefix
+	}
+}
+
+// mintUntil mints the token with an expiry check at expiresAt.
+func mintUntil(key keys.PrivateKey, token mint.Token, expiresAt time.Time) (Result, error) {
+	expiryCheck, err := tokenutil.ExpiryCheck(expiresAt)
+	if err != nil {
+		return Result{}, fmt.Errorf("parsing expiry check: %w", err)
+	}
+
+	token.Checks = append(token.Checks, expiryCheck)
+
+	minted, err := token.Mint(key)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{Token: minted, ExpiresAt: expiresAt.UTC().Truncate(time.Second)}, nil
+}
+
+func (o *OIDC) username(claims map[string]interface{}) (string, error) {
+	username, ok := claims[o.config.UsernameClaim].(string)
+	if !ok || username == "" {
+		return "", fmt.Errorf("ID token has no %s claim, or it is not a string", o.config.UsernameClaim)
+	}
+
+	if o.config.UsernameClaim == "email" {
+		// Some identity providers send email_verified as a string.
+		if verified, ok := claims["email_verified"]; ok && verified != true && verified != "true" {
+			return "", errors.New("ID token email is not verified")
+		}
+	}
+
+	return prefixName("username", o.config.UsernamePrefix, username)
+}
+
+// prefixName prepends the prefix to the name, rejecting names that are,
+// or would become, reserved by Kubernetes, whatever the prefix.
+func prefixName(kind, prefix, name string) (string, error) {
+	if strings.HasPrefix(name, identitypolicy.ReservedPrefix) || strings.HasPrefix(prefix+name, identitypolicy.ReservedPrefix) {
+		return "", fmt.Errorf("ID token %s %q is reserved by Kubernetes", kind, name)
+	}
+
+	return prefix + name, nil
+}
+
+func (o *OIDC) groups(claims map[string]interface{}) ([]string, error) {
+	if o.config.GroupsClaim == "" {
+		return nil, nil
+	}
+
+	names := []string{}
+
+	switch value := claims[o.config.GroupsClaim].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		names = append(names, value)
+	case []interface{}:
+		for _, group := range value {
+			groupString, ok := group.(string)
+			if !ok {
+				return nil, fmt.Errorf("ID token %s claim must only contain strings", o.config.GroupsClaim)
+			}
+			names = append(names, groupString)
+		}
+	default:
+		return nil, fmt.Errorf("ID token %s claim must be a string or a list of strings", o.config.GroupsClaim)
+	}
+
+	groups := make([]string, 0, len(names))
+	for _, name := range names {
+		group, err := prefixName("group", o.config.GroupsPrefix, name)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,419 @@
+package exchange
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/everettraven/biscuit/pkg/authenticator"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/everettraven/biscuit/pkg/tokenutil"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const testIssuer = "https://idp.example.com"
+
+var testNow = time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// testIDP signs ID tokens with keys published in a JWKS file.
+type testIDP struct {
+	keys     map[string]ed25519.PrivateKey
+	jwksFile *JWKSFile
+}
+
+// newTestIDP returns an identity provider publishing a key for each of
+// the key IDs.
+func newTestIDP(t *testing.T, keyIDs ...string) *testIDP {
+	t.Helper()
+
+	idp := &testIDP{keys: map[string]ed25519.PrivateKey{}}
+	keySet := jose.JSONWebKeySet{}
+
+	for _, keyID := range keyIDs {
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("generating key: %v", err)
+		}
+
+		idp.keys[keyID] = private
+		keySet.Keys = append(keySet.Keys, jose.JSONWebKey{Key: public, KeyID: keyID, Algorithm: string(jose.EdDSA), Use: "sig"})
+	}
+
+	data, err := json.Marshal(keySet)
+	if err != nil {
+		t.Fatalf("marshalling JWKS: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("writing JWKS: %v", err)
+	}
+
+	idp.jwksFile, err = NewJWKSFile(path)
+	if err != nil {
+		t.Fatalf("loading JWKS: %v", err)
+	}
+
+	return idp
+}
+
+// sign returns an ID token signed with key, carrying keyID in its header.
+func sign(t *testing.T, key ed25519.PrivateKey, keyID string, registered jwt.Claims, claims map[string]interface{}) string {
+	t.Helper()
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.EdDSA, Key: jose.JSONWebKey{Key: key, KeyID: keyID}}, (&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		t.Fatalf("creating signer: %v", err)
+	}
+
+	idToken, err := jwt.Signed(signer).Claims(registered).Claims(claims).Serialize()
+	if err != nil {
+		t.Fatalf("signing ID token: %v", err)
+	}
+
+	return idToken
+}
+
+// registeredClaims returns valid registered claims expiring after ttl.
+func registeredClaims(ttl time.Duration) jwt.Claims {
+	return jwt.Claims{
+		Issuer:   testIssuer,
+		Audience: jwt.Audience{"kubernetes"},
+		IssuedAt: jwt.NewNumericDate(testNow),
+		Expiry:   jwt.NewNumericDate(testNow.Add(ttl)),
+	}
+}
+
+// newTestOIDC returns an exchanger for the identity provider, along with
+// the public key verifying the tokens it mints.
+func newTestOIDC(t *testing.T, idp *testIDP, config OIDCConfig) (*OIDC, ed25519.PublicKey) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	config.Issuer = testIssuer
+	config.Audience = "kubernetes"
+	if config.UsernameClaim == "" {
+		config.UsernameClaim = "sub"
+	}
+	if config.TTL == 0 {
+		config.TTL = time.Hour
+	}
+
+	oidc, err := NewOIDC(config, idp.jwksFile, keys.PrivateKey{Key: private})
+	if err != nil {
+		t.Fatalf("creating exchanger: %v", err)
+	}
+	oidc.now = func() time.Time { return testNow }
+
+	return oidc, public
+}
+
+func TestOIDCClaimMapping(t *testing.T) {
+	idp := newTestIDP(t, "one")
+
+	tests := []struct {
+		name       string
+		config     OIDCConfig
+		claims     map[string]interface{}
+		wantName   string
+		wantGroups []string
+		wantErr    bool
+	}{
+		{
+			name:       "issuer prefixes by default",
+			config:     OIDCConfig{GroupsClaim: "groups"},
+			claims:     map[string]interface{}{"sub": "jane", "groups": []string{"dev", "ops"}},
+			wantName:   testIssuer + "#jane",
+			wantGroups: []string{testIssuer + "#dev", testIssuer + "#ops"},
+		},
+		{
+			name:       "custom prefixes",
+			config:     OIDCConfig{GroupsClaim: "groups", UsernamePrefix: "oidc:", GroupsPrefix: "oidc:"},
+			claims:     map[string]interface{}{"sub": "jane", "groups": []string{"dev"}},
+			wantName:   "oidc:jane",
+			wantGroups: []string{"oidc:dev"},
+		},
+		{
+			name:       "disabled prefixes",
+			config:     OIDCConfig{GroupsClaim: "groups", UsernamePrefix: "-", GroupsPrefix: "-"},
+			claims:     map[string]interface{}{"sub": "jane", "groups": "dev"},
+			wantName:   "jane",
+			wantGroups: []string{"dev"},
+		},
+		{
+			name:     "missing groups claim",
+			config:   OIDCConfig{GroupsClaim: "groups"},
+			claims:   map[string]interface{}{"sub": "jane"},
+			wantName: testIssuer + "#jane",
+		},
+		{
+			name:    "groups claim with a non-string",
+			config:  OIDCConfig{GroupsClaim: "groups"},
+			claims:  map[string]interface{}{"sub": "jane", "groups": []interface{}{"dev", 1}},
+			wantErr: true,
+		},
+		{
+			name:    "missing username claim",
+			claims:  map[string]interface{}{"email": "jane@example.com"},
+			wantErr: true,
+		},
+		{
+			name:     "email is not prefixed by default",
+			config:   OIDCConfig{UsernameClaim: "email"},
+			claims:   map[string]interface{}{"sub": "1234", "email": "jane@example.com", "email_verified": true},
+			wantName: "jane@example.com",
+		},
+		{
+			name:     "email verified as a string",
+			config:   OIDCConfig{UsernameClaim: "email"},
+			claims:   map[string]interface{}{"sub": "1234", "email": "jane@example.com", "email_verified": "true"},
+			wantName: "jane@example.com",
+		},
+		{
+			name:    "email not verified",
+			config:  OIDCConfig{UsernameClaim: "email"},
+			claims:  map[string]interface{}{"sub": "1234", "email": "jane@example.com", "email_verified": false},
+			wantErr: true,
+		},
+		{
+			name:    "email not verified as a string",
+			config:  OIDCConfig{UsernameClaim: "email"},
+			claims:  map[string]interface{}{"sub": "1234", "email": "jane@example.com", "email_verified": "false"},
+			wantErr: true,
+		},
+		{
+			name:    "system: username",
+			config:  OIDCConfig{UsernamePrefix: "-"},
+			claims:  map[string]interface{}{"sub": "system:admin"},
+			wantErr: true,
+		},
+		{
+			name:    "system: group without a prefix",
+			config:  OIDCConfig{GroupsClaim: "groups", GroupsPrefix: "-"},
+			claims:  map[string]interface{}{"sub": "jane", "groups": []string{"system:masters"}},
+			wantErr: true,
+		},
+		{
+			name:    "system: group with a prefix",
+			config:  OIDCConfig{GroupsClaim: "groups"},
+			claims:  map[string]interface{}{"sub": "jane", "groups": []string{"system:masters"}},
+			wantErr: true,
+		},
+		{
+			name:    "system: prefix",
+			config:  OIDCConfig{UsernamePrefix: "system:"},
+			claims:  map[string]interface{}{"sub": "jane"},
+			wantErr: true,
+		},
+		{
+			name:    "comma in a group",
+			config:  OIDCConfig{GroupsClaim: "groups"},
+			claims:  map[string]interface{}{"sub": "jane", "groups": []string{"dev,ops"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oidc, public := newTestOIDC(t, idp, tt.config)
+			idToken := sign(t, idp.keys["one"], "one", registeredClaims(time.Hour), tt.claims)
+
+			result, err := oidc.Exchange(context.Background(), idToken)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("exchanging ID token: %v", err)
+			}
+
+			b, err := tokenutil.Limits{}.Decode(result.Token)
+			if err != nil {
+				t.Fatalf("decoding token: %v", err)
+			}
+
+			authz, err := b.Authorizer(public)
+			if err != nil {
+				t.Fatalf("verifying token: %v", err)
+			}
+
+			identity, err := authenticator.TokenIdentity(authz)
+			if err != nil {
+				t.Fatalf("reading identity: %v", err)
+			}
+
+			if identity.GetName() != tt.wantName {
+				t.Errorf("got username %q, want %q", identity.GetName(), tt.wantName)
+			}
+
+			if !slices.Equal(identity.GetGroups(), tt.wantGroups) && len(identity.GetGroups())+len(tt.wantGroups) > 0 {
+				t.Errorf("got groups %q, want %q", identity.GetGroups(), tt.wantGroups)
+			}
+		})
+	}
+}
+
+func TestOIDCExpiry(t *testing.T) {
+	idp := newTestIDP(t, "one")
+
+	tests := []struct {
+		name          string
+		ttl           time.Duration
+		idTokenTTL    time.Duration
+		wantExpiresAt time.Time
+		wantErr       bool
+	}{
+		{
+			name:          "bounded by the TTL",
+			ttl:           time.Hour,
+			idTokenTTL:    2 * time.Hour,
+			wantExpiresAt: testNow.Add(time.Hour),
+		},
+		{
+			name:          "bounded by the ID token",
+			ttl:           time.Hour,
+			idTokenTTL:    10*time.Minute + 500*time.Millisecond,
+			wantExpiresAt: testNow.Add(10 * time.Minute),
+		},
+		{
+			name:       "expired ID token",
+			ttl:        time.Hour,
+			idTokenTTL: -time.Minute,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oidc, _ := newTestOIDC(t, idp, OIDCConfig{TTL: tt.ttl})
+			idToken := sign(t, idp.keys["one"], "one", registeredClaims(tt.idTokenTTL), map[string]interface{}{"sub": "jane"})
+
+			result, err := oidc.Exchange(context.Background(), idToken)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("exchanging ID token: %v", err)
+			}
+
+			if !result.ExpiresAt.Equal(tt.wantExpiresAt) {
+				t.Errorf("got expiry %v, want %v", result.ExpiresAt, tt.wantExpiresAt)
+			}
+		})
+	}
+}
+
+func TestOIDCMissingExpiry(t *testing.T) {
+	idp := newTestIDP(t, "one")
+	oidc, _ := newTestOIDC(t, idp, OIDCConfig{})
+
+	registered := registeredClaims(time.Hour)
+	registered.Expiry = nil
+
+	if _, err := oidc.Exchange(context.Background(), sign(t, idp.keys["one"], "one", registered, map[string]interface{}{"sub": "jane"})); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestOIDCKeySelection(t *testing.T) {
+	idp := newTestIDP(t, "one", "two")
+	other := newTestIDP(t, "one", "three")
+
+	tests := []struct {
+		name       string
+		key        ed25519.PrivateKey
+		keyID      string
+		registered jwt.Claims
+		wantErr    bool
+	}{
+		{
+			name:       "first key",
+			key:        idp.keys["one"],
+			keyID:      "one",
+			registered: registeredClaims(time.Hour),
+		},
+		{
+			name:       "second key",
+			key:        idp.keys["two"],
+			keyID:      "two",
+			registered: registeredClaims(time.Hour),
+		},
+		{
+			name:       "key ID of another key",
+			key:        idp.keys["two"],
+			keyID:      "one",
+			registered: registeredClaims(time.Hour),
+			wantErr:    true,
+		},
+		{
+			name:       "untrusted key with a trusted key ID",
+			key:        other.keys["one"],
+			keyID:      "one",
+			registered: registeredClaims(time.Hour),
+			wantErr:    true,
+		},
+		{
+			name:       "unknown key ID",
+			key:        other.keys["three"],
+			keyID:      "three",
+			registered: registeredClaims(time.Hour),
+			wantErr:    true,
+		},
+		{
+			name:  "other issuer",
+			key:   idp.keys["one"],
+			keyID: "one",
+			registered: jwt.Claims{
+				Issuer:   "https://evil.example.com",
+				Audience: jwt.Audience{"kubernetes"},
+				Expiry:   jwt.NewNumericDate(testNow.Add(time.Hour)),
+			},
+			wantErr: true,
+		},
+		{
+			name:  "other audience",
+			key:   idp.keys["one"],
+			keyID: "one",
+			registered: jwt.Claims{
+				Issuer:   testIssuer,
+				Audience: jwt.Audience{"other"},
+				Expiry:   jwt.NewNumericDate(testNow.Add(time.Hour)),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oidc, _ := newTestOIDC(t, idp, OIDCConfig{})
+			idToken := sign(t, tt.key, tt.keyID, tt.registered, map[string]interface{}{"sub": "jane"})
+
+			_, err := oidc.Exchange(context.Background(), idToken)
+			if tt.wantErr && err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if !tt.wantErr && err != nil {
+				t.Fatalf("exchanging ID token: %v", err)
+			}
+		})
+	}
+}
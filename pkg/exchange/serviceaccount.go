@@ -0,0 +1,223 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/everettraven/biscuit/pkg/identitypolicy"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/everettraven/biscuit/pkg/mint"
+	"github.com/go-jose/go-jose/v4/jwt"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// boundExtraKeys are the extra attributes describing the pod and node a
+// ServiceAccount token is bound to, which are carried into the minted
+// token.
+var boundExtraKeys = []string{
+	serviceaccount.PodNameKey,
+	serviceaccount.PodUIDKey,
+	serviceaccount.NodeNameKey,
+	serviceaccount.NodeUIDKey,
+	user.CredentialIDKey,
+}
+
+// Reviewer reviews tokens, as the TokenReview API of a Kubernetes API
+// server does.
+type Reviewer interface {
+	Review(ctx context.Context, token string, audiences []string) (authenticationv1.TokenReviewStatus, error)
+}
+
+// TokenReviewer reviews tokens with the TokenReview API of a Kubernetes
+// API server.
+type TokenReviewer struct {
+	client *http.Client
+	url    string
+}
+
+// NewTokenReviewer returns a reviewer for the API server of the
+// kubeconfig, or for the cluster it runs in when kubeconfig is empty.
+func NewTokenReviewer(kubeconfig string) (*TokenReviewer, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+
+	client, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating API server client: %w", err)
+	}
+
+	return &TokenReviewer{
+		client: client,
+		url:    strings.TrimSuffix(config.Host, "/") + "/apis/authentication.k8s.io/v1/tokenreviews",
+	}, nil
+}
+
+// Review returns the status of a TokenReview of the token for the
+// audiences.
+func (r *TokenReviewer) Review(ctx context.Context, token string, audiences []string) (authenticationv1.TokenReviewStatus, error) {
+	body, err := json.Marshal(authenticationv1.TokenReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: authenticationv1.SchemeGroupVersion.String(),
+			Kind:       "TokenReview",
+		},
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: audiences,
+		},
+	})
+	if err != nil {
+		return authenticationv1.TokenReviewStatus{}, fmt.Errorf("marshalling token review: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return authenticationv1.TokenReviewStatus{}, fmt.Errorf("creating token review request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return authenticationv1.TokenReviewStatus{}, fmt.Errorf("creating token review: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return authenticationv1.TokenReviewStatus{}, fmt.Errorf("reading token review: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return authenticationv1.TokenReviewStatus{}, fmt.Errorf("creating token review: %s", resp.Status)
+	}
+
+	review := authenticationv1.TokenReview{}
+	if err := json.Unmarshal(respBody, &review); err != nil {
+		return authenticationv1.TokenReviewStatus{}, fmt.Errorf("unmarshalling token review: %w", err)
+	}
+
+	return review.Status, nil
+}
+
+// ServiceAccountConfig sets which ServiceAccount tokens are accepted.
+type ServiceAccountConfig struct {
+	// Audiences are the audiences tokens must be issued for. When empty,
+	// the API server's audiences are used.
+	Audiences []string
+
+	// TTL bounds the lifetime of minted tokens, which never outlive the
+	// ServiceAccount token they were exchanged for.
+	TTL time.Duration
+
+	// IdentityPolicy, if set, is the identity policy of the webhook. The
+	// system: names of ServiceAccounts are rejected by it unless they
+	// are allowed for the signing key, so exchanges it would reject fail
+	// rather than minting tokens that cannot authenticate.
+	IdentityPolicy *identitypolicy.File
+}
+
+// NewServiceAccount returns an exchanger minting biscuit tokens signed
+// with key for ServiceAccount tokens accepted by the reviewer.
+func NewServiceAccount(config ServiceAccountConfig, reviewer Reviewer, key keys.PrivateKey) (*ServiceAccount, error) {
+	if config.TTL <= 0 {
+		return nil, errors.New("the TTL of exchanged tokens must be positive")
+	}
+
+	return &ServiceAccount{
+		config:   config,
+		reviewer: reviewer,
+		key:      key,
+		now:      time.Now,
+	}, nil
+}
+
+type ServiceAccount struct {
+	config   ServiceAccountConfig
+	reviewer Reviewer
+	key      keys.PrivateKey
+	now      func() time.Time
+}
+
+// Exchange reviews the ServiceAccount token and mints a biscuit token
+// for the ServiceAccount, carrying the pod binding extras.
+func (s *ServiceAccount) Exchange(ctx context.Context, saToken string) (Result, error) {
+	// The token is parsed without verification only to bound the minted
+	// token's lifetime. It is verified by the API server.
+	parsed, err := jwt.ParseSigned(saToken, signatureAlgorithms)
+	if err != nil {
+		return Result{}, fmt.Errorf("parsing ServiceAccount token: %w", err)
+	}
+
+	claims := jwt.Claims{}
+	if err := parsed.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return Result{}, fmt.Errorf("parsing ServiceAccount token: %w", err)
+	}
+
+	status, err := s.reviewer.Review(ctx, saToken, s.config.Audiences)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if !status.Authenticated {
+		if status.Error != "" {
+			return Result{}, fmt.Errorf("ServiceAccount token is not authenticated: %s", status.Error)
+		}
+		return Result{}, errors.New("ServiceAccount token is not authenticated")
+	}
+
+	// A reviewer ignoring the requested audiences would accept tokens
+	// issued for any of them.
+	if len(s.config.Audiences) > 0 && !slices.ContainsFunc(status.Audiences, func(audience string) bool {
+		return slices.Contains(s.config.Audiences, audience)
+	}) {
+		return Result{}, fmt.Errorf("ServiceAccount token is not authenticated for any of the audiences %q", s.config.Audiences)
+	}
+
+	if _, _, err := serviceaccount.SplitUsername(status.User.Username); err != nil {
+		return Result{}, fmt.Errorf("token does not belong to a ServiceAccount: %w", err)
+	}
+
+	// The API server adds system:authenticated to every user it
+	// authenticates, including those of biscuit tokens.
+	groups := slices.DeleteFunc(slices.Clone(status.User.Groups), func(group string) bool {
+		return group == user.AllAuthenticated
+	})
+
+	if s.config.IdentityPolicy != nil {
+		if err := s.config.IdentityPolicy.Current().Check(s.key.ID, s.key.HasID, status.User.Username, groups); err != nil {
+			return Result{}, fmt.Errorf("%w: allow system:serviceaccount:* usernames and system:serviceaccounts* groups for the signing key to exchange ServiceAccount tokens", err)
+		}
+	}
+
+	extra := map[string][]string{}
+	for _, key := range boundExtraKeys {
+		if values := status.User.Extra[key]; len(values) > 0 {
+			extra[key] = values
+		}
+	}
+
+	expiresAt := s.now().Add(s.config.TTL)
+	if claims.Expiry != nil && claims.Expiry.Time().Before(expiresAt) {
+		expiresAt = claims.Expiry.Time()
+	}
+
+	return mintUntil(s.key, mint.Token{
+		Username:   status.User.Username,
+		Groups:     groups,
+		BoundExtra: extra,
+	}, expiresAt)
+}
@@ -0,0 +1,244 @@
+package exchange
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/everettraven/biscuit/pkg/authenticator"
+	"github.com/everettraven/biscuit/pkg/identitypolicy"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/everettraven/biscuit/pkg/tokenutil"
+	"github.com/go-jose/go-jose/v4/jwt"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// reviewedToken is how the test API server reviews a token.
+type reviewedToken struct {
+	user      authenticationv1.UserInfo
+	audiences []string
+}
+
+// newTestAPIServer returns a reviewer for a stand-in for the TokenReview
+// API, authenticating the tokens for their audiences. If
+// ignoreAudiences is set, it authenticates them for any audience, as a
+// misconfigured server would.
+func newTestAPIServer(t *testing.T, tokens map[string]reviewedToken, ignoreAudiences bool) *TokenReviewer {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		review := authenticationv1.TokenReview{}
+		if err := json.NewDecoder(req.Body).Decode(&review); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		token, ok := tokens[review.Spec.Token]
+		audiences := token.audiences
+		if !ignoreAudiences && len(review.Spec.Audiences) > 0 {
+			audiences = slices.DeleteFunc(slices.Clone(review.Spec.Audiences), func(audience string) bool {
+				return !slices.Contains(token.audiences, audience)
+			})
+		}
+
+		switch {
+		case !ok:
+			review.Status = authenticationv1.TokenReviewStatus{Error: "invalid bearer token"}
+		case len(audiences) == 0:
+			review.Status = authenticationv1.TokenReviewStatus{Error: "token audiences are invalid"}
+		default:
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: token.user, Audiences: audiences}
+		}
+
+		rw.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(rw).Encode(review)
+	}))
+	t.Cleanup(server.Close)
+
+	return &TokenReviewer{client: server.Client(), url: server.URL}
+}
+
+// serviceAccountToken returns an unverified JWT expiring after ttl,
+// which the exchanger only reads the expiry of.
+func serviceAccountToken(t *testing.T, ttl time.Duration) string {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	return sign(t, private, "sa", jwt.Claims{Expiry: jwt.NewNumericDate(testNow.Add(ttl))}, map[string]interface{}{})
+}
+
+func TestServiceAccountExchange(t *testing.T) {
+	builder := authenticationv1.UserInfo{
+		Username: "system:serviceaccount:ci:builder",
+		Groups:   []string{"system:serviceaccounts", "system:serviceaccounts:ci", user.AllAuthenticated},
+		Extra: map[string]authenticationv1.ExtraValue{
+			serviceaccount.PodNameKey:  {"builder-7d9f"},
+			serviceaccount.PodUIDKey:   {"0b5c"},
+			serviceaccount.NodeNameKey: {"node-1"},
+			user.CredentialIDKey:       {"JTI=1234"},
+			"example.com/unrelated":    {"value"},
+		},
+	}
+
+	boundToken := serviceAccountToken(t, 10*time.Minute)
+	otherAudienceToken := serviceAccountToken(t, time.Hour)
+	userToken := serviceAccountToken(t, time.Hour)
+
+	tokens := map[string]reviewedToken{
+		boundToken:         {user: builder, audiences: []string{"biscuit"}},
+		otherAudienceToken: {user: builder, audiences: []string{"vault"}},
+		userToken:          {user: authenticationv1.UserInfo{Username: "jane"}, audiences: []string{"biscuit"}},
+	}
+
+	allowServiceAccounts := []byte(`rules:
+- allowedUsernames: ["system:serviceaccount:*"]
+  allowedGroups: ["system:serviceaccounts", "system:serviceaccounts:*"]
+`)
+
+	tests := []struct {
+		name            string
+		token           string
+		ignoreAudiences bool
+		identityPolicy  []byte
+		wantErr         bool
+		wantExpiresAt   time.Time
+	}{
+		{
+			name:          "authenticated",
+			token:         boundToken,
+			wantExpiresAt: testNow.Add(10 * time.Minute),
+		},
+		{
+			name:    "unauthenticated",
+			token:   serviceAccountToken(t, time.Hour),
+			wantErr: true,
+		},
+		{
+			name:    "audience mismatch",
+			token:   otherAudienceToken,
+			wantErr: true,
+		},
+		{
+			name:            "audience mismatch ignored by the reviewer",
+			token:           otherAudienceToken,
+			ignoreAudiences: true,
+			wantErr:         true,
+		},
+		{
+			name:    "not a ServiceAccount",
+			token:   userToken,
+			wantErr: true,
+		},
+		{
+			name:           "allowed by the identity policy",
+			token:          boundToken,
+			wantExpiresAt:  testNow.Add(10 * time.Minute),
+			identityPolicy: allowServiceAccounts,
+		},
+		{
+			name:           "rejected by the default identity policy",
+			token:          boundToken,
+			identityPolicy: []byte("rules: []\n"),
+			wantErr:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			public, private, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatalf("generating key: %v", err)
+			}
+
+			config := ServiceAccountConfig{Audiences: []string{"biscuit"}, TTL: time.Hour}
+			if tt.identityPolicy != nil {
+				path := filepath.Join(t.TempDir(), "identity-policy.yaml")
+				if err := os.WriteFile(path, tt.identityPolicy, 0o600); err != nil {
+					t.Fatalf("writing identity policy: %v", err)
+				}
+
+				config.IdentityPolicy, err = identitypolicy.NewFile(path)
+				if err != nil {
+					t.Fatalf("loading identity policy: %v", err)
+				}
+			}
+
+			sa, err := NewServiceAccount(config, newTestAPIServer(t, tokens, tt.ignoreAudiences), keys.PrivateKey{Key: private})
+			if err != nil {
+				t.Fatalf("creating exchanger: %v", err)
+			}
+			sa.now = func() time.Time { return testNow }
+
+			result, err := sa.Exchange(context.Background(), tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("exchanging token: %v", err)
+			}
+
+			if !result.ExpiresAt.Equal(tt.wantExpiresAt) {
+				t.Errorf("got expiry %v, want %v", result.ExpiresAt, tt.wantExpiresAt)
+			}
+
+			b, err := tokenutil.Limits{}.Decode(result.Token)
+			if err != nil {
+				t.Fatalf("decoding token: %v", err)
+			}
+
+			authz, err := b.Authorizer(public)
+			if err != nil {
+				t.Fatalf("verifying token: %v", err)
+			}
+
+			identity, err := authenticator.TokenIdentity(authz)
+			if err != nil {
+				t.Fatalf("reading identity: %v", err)
+			}
+
+			if identity.GetName() != builder.Username {
+				t.Errorf("got username %q, want %q", identity.GetName(), builder.Username)
+			}
+
+			wantGroups := []string{"system:serviceaccounts", "system:serviceaccounts:ci"}
+			if !slices.Equal(identity.GetGroups(), wantGroups) {
+				t.Errorf("got groups %q, want %q", identity.GetGroups(), wantGroups)
+			}
+
+			wantExtra := map[string][]string{
+				serviceaccount.PodNameKey:  {"builder-7d9f"},
+				serviceaccount.PodUIDKey:   {"0b5c"},
+				serviceaccount.NodeNameKey: {"node-1"},
+				user.CredentialIDKey:       {"JTI=1234"},
+			}
+			extra := identity.GetExtra()
+			for key, values := range wantExtra {
+				if !slices.Equal(extra[key], values) {
+					t.Errorf("got extra %s=%q, want %q", key, extra[key], values)
+				}
+			}
+
+			if _, ok := extra["example.com/unrelated"]; ok {
+				t.Error("unrelated extra was carried into the token")
+			}
+		})
+	}
+}
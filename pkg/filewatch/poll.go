@@ -0,0 +1,44 @@
+package filewatch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"log"
+	"os"
+	"time"
+)
+
+// Poll reads the file at path every interval and calls onChange with its
+// contents whenever they differ from initial, the contents last loaded
+// by the caller. Polling rather than filesystem notifications keeps this
+// working for mounted Secrets and ConfigMaps, which are updated through
+// symlink swaps. Poll blocks until ctx is cancelled.
+func Poll(ctx context.Context, path string, interval time.Duration, initial []byte, onChange func(data []byte)) {
+	last := sha256.Sum256(initial)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("error reading %s: %v\n", path, err)
+			continue
+		}
+
+		sum := sha256.Sum256(data)
+		if bytes.Equal(sum[:], last[:]) {
+			continue
+		}
+
+		last = sum
+		onChange(data)
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/everettraven/biscuit/pkg/attenuation"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/everettraven/biscuit/pkg/tokenutil"
+)
+
+func NewAttenuate(publicKeys *keys.Store, limits tokenutil.Limits) *Attenuate {
+	return &Attenuate{
+		keys:   publicKeys,
+		limits: limits,
+		now:    time.Now,
+	}
+}
+
+// Attenuate attenuates the tokens POSTed to it as an
+// attenuation.Request. Only tokens signed by a trusted key, and within
+// the limits both before and after attenuation, are attenuated.
+type Attenuate struct {
+	keys   *keys.Store
+	limits tokenutil.Limits
+	now    func() time.Time
+}
+
+func (a *Attenuate) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	attenuationRequest := attenuation.Request{}
+	if err := json.NewDecoder(http.MaxBytesReader(rw, req.Body, 1<<20)).Decode(&attenuationRequest); err != nil {
+		log.Printf("error unmarshalling request body: %v\n", err)
+		writeJSON(rw, http.StatusBadRequest, errorResponse{Error: "invalid request body"})
+		return
+	}
+
+	attenuated, err := a.attenuate(attenuationRequest)
+	if err != nil {
+		log.Printf("rejecting attenuation: %v\n", err)
+		writeJSON(rw, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, attenuation.Response{Token: attenuated})
+}
+
+func (a *Attenuate) attenuate(attenuationRequest attenuation.Request) (string, error) {
+	now := a.now()
+
+	token, err := a.limits.Decode(attenuationRequest.Token)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := a.keys.Current().VerifyingKey(token, now); err != nil {
+		return "", fmt.Errorf("verifying token: %w", err)
+	}
+
+	serialized, err := base64.URLEncoding.DecodeString(attenuationRequest.Token)
+	if err != nil {
+		return "", fmt.Errorf("decoding token: %w", err)
+	}
+
+	attenuated, err := attenuation.Attenuate(serialized, attenuationRequest.Attenuation, now)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.URLEncoding.EncodeToString(attenuated)
+	if _, err := a.limits.Decode(encoded); err != nil {
+		return "", fmt.Errorf("attenuated token: %w", err)
+	}
+
+	return encoded, nil
+}
@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
 
+	"github.com/everettraven/biscuit/pkg/tokenutil"
 	authenticationv1 "k8s.io/api/authentication/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apiserver/pkg/authentication/authenticator"
@@ -44,9 +46,18 @@ func (a *Authenticate) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		},
 	}
 
-	resp, _, err := a.authenticator.AuthenticateToken(req.Context(), requestedTokenReview.Spec.Token)
+	ctx := req.Context()
+	if len(requestedTokenReview.Spec.Audiences) > 0 {
+		ctx = authenticator.WithAudiences(ctx, requestedTokenReview.Spec.Audiences)
+	}
+
+	resp, _, err := a.authenticator.AuthenticateToken(ctx, requestedTokenReview.Spec.Token)
 	if err != nil {
-		log.Println(err)
+		if errors.Is(err, tokenutil.ErrLimitExceeded) {
+			log.Printf("rejecting token, it exceeds limits: %v\n", err)
+		} else {
+			log.Println(err)
+		}
 		responseTokenReview.Status = authenticationv1.TokenReviewStatus{
 			Authenticated: false,
 			Error:         err.Error(),
@@ -1,13 +1,15 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"log"
 	"net/http"
-	"strings"
 
+	localauthorizer "github.com/everettraven/biscuit/pkg/authorizer"
+	"github.com/everettraven/biscuit/pkg/tokenutil"
 	authorizationv1api "k8s.io/api/authorization/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
@@ -16,14 +18,46 @@ import (
 	"k8s.io/kubernetes/pkg/registry/authorization/util"
 )
 
-func NewAuthorize(authrzr authorizer.Authorizer) *Authorize {
-	return &Authorize{
+func NewAuthorize(authrzr authorizer.Authorizer, opts ...AuthorizeOption) *Authorize {
+	a := &Authorize{
 		authorizer: authrzr,
 	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+type AuthorizeOption func(*Authorize)
+
+// Explainer explains the decision an authorizer makes for a request.
+type Explainer interface {
+	Explain(ctx context.Context, attrs authorizer.Attributes) (*localauthorizer.Explanation, error)
+}
+
+// WithVerboseReasons replaces the reason of denied requests with the
+// failed checks and the matching deny policy, and logs it.
+func WithVerboseReasons(explainer Explainer) AuthorizeOption {
+	return func(a *Authorize) {
+		a.explainer = explainer
+	}
+}
+
+// WithWorldLogging also logs the Datalog world denied requests were
+// evaluated in when verbose reasons are enabled. The world holds every
+// fact of the token, including the identity and its extras.
+func WithWorldLogging(enabled bool) AuthorizeOption {
+	return func(a *Authorize) {
+		a.logWorld = enabled
+	}
 }
 
 type Authorize struct {
 	authorizer authorizer.Authorizer
+	explainer  Explainer
+	logWorld   bool
 }
 
 func (a *Authorize) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
@@ -42,12 +76,6 @@ func (a *Authorize) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	fmt.Println("XXX DEBUG requested SAR user:", string(requestedSAR.Spec.User))
-
-	if strings.Contains(requestedSAR.Spec.User, "biscuit:") {
-		fmt.Println("XXX DEBUG requested SAR:", string(requestedSARBytes))
-	}
-
 	apiSAR := &authorizationapi.SubjectAccessReview{}
 	err = authorizationv1.Convert_v1_SubjectAccessReview_To_authorization_SubjectAccessReview(requestedSAR, apiSAR, nil)
 	if err != nil {
@@ -67,11 +95,15 @@ func (a *Authorize) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 
 	decision, reason, err := a.authorizer.Authorize(req.Context(), attrsRecord)
 
-	log.Println("XXX DEBUG: decision:", decision)
-	log.Println("XXX DEBUG: reason:", reason)
-	log.Println("XXX DEBUG: error:", err)
-
-	if err != nil {
+	if errors.Is(err, tokenutil.ErrLimitExceeded) {
+		log.Printf("denying request from %q, biscuit token exceeds limits: %v\n", requestedSAR.Spec.User, err)
+		responseSAR.Status = authorizationv1api.SubjectAccessReviewStatus{
+			Allowed:         false,
+			Denied:          true,
+			Reason:          "biscuit token exceeds limits",
+			EvaluationError: err.Error(),
+		}
+	} else if err != nil {
 		log.Println(err)
 		responseSAR.Status = authorizationv1api.SubjectAccessReviewStatus{
 			Allowed:         false,
@@ -92,7 +124,7 @@ func (a *Authorize) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 			responseSAR.Status = authorizationv1api.SubjectAccessReviewStatus{
 				Allowed: false,
 				Denied:  true,
-				Reason:  reason,
+				Reason:  a.explainReason(req.Context(), attrsRecord, reason),
 			}
 		}
 	}
@@ -106,3 +138,26 @@ func (a *Authorize) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 
 	rw.Write(responseSARBytes)
 }
+
+// explainReason returns the reason for denying the request, explained in
+// full when verbose reasons are enabled.
+func (a *Authorize) explainReason(ctx context.Context, attrs authorizer.Attributes, reason string) string {
+	if a.explainer == nil {
+		return reason
+	}
+
+	explanation, err := a.explainer.Explain(ctx, attrs)
+	if err != nil {
+		log.Printf("error explaining decision: %v\n", err)
+		return reason
+	}
+
+	summary := explanation.Summary()
+	log.Printf("denied request from %q: %s\n", attrs.GetUser().GetName(), summary)
+
+	if a.logWorld && explanation.World != "" {
+		log.Printf("denied request from %q evaluated in world:\n%s\n", attrs.GetUser().GetName(), explanation.World)
+	}
+
+	return summary
+}
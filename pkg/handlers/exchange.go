@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/everettraven/biscuit/pkg/exchange"
+)
+
+// Exchanger mints a biscuit token in exchange for another token.
+type Exchanger interface {
+	Exchange(ctx context.Context, token string) (exchange.Result, error)
+}
+
+func NewExchange(exchanger Exchanger) *Exchange {
+	return &Exchange{
+		exchanger: exchanger,
+	}
+}
+
+// Exchange mints biscuit tokens in exchange for the tokens POSTed to it
+// as an exchange.Request.
+type Exchange struct {
+	exchanger Exchanger
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (e *Exchange) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	exchangeRequest := exchange.Request{}
+	if err := json.NewDecoder(http.MaxBytesReader(rw, req.Body, 1<<20)).Decode(&exchangeRequest); err != nil {
+		log.Printf("error unmarshalling request body: %v\n", err)
+		writeJSON(rw, http.StatusBadRequest, errorResponse{Error: "invalid request body"})
+		return
+	}
+
+	result, err := e.exchanger.Exchange(req.Context(), exchangeRequest.Token)
+	if err != nil {
+		log.Printf("rejecting token exchange: %v\n", err)
+		writeJSON(rw, http.StatusUnauthorized, errorResponse{Error: err.Error()})
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, result)
+}
+
+func writeJSON(rw http.ResponseWriter, status int, body any) {
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	rw.Write(bodyBytes)
+}
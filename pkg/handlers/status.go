@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/everettraven/biscuit/pkg/keys"
+)
+
+func NewStatus(publicKeys *keys.Store) *Status {
+	return &Status{
+		keys: publicKeys,
+	}
+}
+
+// Status reports the fingerprints of the public keys in use, so that
+// key rotations can be confirmed to have been picked up.
+type Status struct {
+	keys *keys.Store
+}
+
+func (s *Status) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	statusBytes, err := json.Marshal(s.keys.Status())
+	if err != nil {
+		log.Println(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(statusBytes)
+}
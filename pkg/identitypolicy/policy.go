@@ -0,0 +1,185 @@
+package identitypolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/everettraven/biscuit/pkg/filewatch"
+	"sigs.k8s.io/yaml"
+)
+
+// ReservedPrefix is the prefix of the usernames and groups reserved by
+// Kubernetes, e.g. system:masters. Identities using it are rejected
+// unless a rule explicitly allows them.
+const ReservedPrefix = "system:"
+
+// ErrForbidden is wrapped by the errors reporting an identity the policy
+// does not allow.
+var ErrForbidden = errors.New("identity is forbidden by the identity policy")
+
+// Policy restricts the identities tokens may carry, depending on the key
+// that signed them. Patterns match a name exactly or, with a trailing
+// '*', any name with the given prefix.
+type Policy struct {
+	// Rules apply to tokens signed by the key with their KeyID. A rule
+	// without a KeyID applies to tokens signed by any other key.
+	Rules []Rule `json:"rules"`
+}
+
+// Rule lists the usernames and groups tokens signed by a key may or may
+// not carry. Names matching an allowed pattern are accepted even if they
+// also match a forbidden pattern or the reserved prefix. When allowed
+// patterns are set, names matching none of them are rejected.
+type Rule struct {
+	KeyID *uint32 `json:"keyID,omitempty"`
+
+	AllowedUsernames   []string `json:"allowedUsernames,omitempty"`
+	ForbiddenUsernames []string `json:"forbiddenUsernames,omitempty"`
+	AllowedGroups      []string `json:"allowedGroups,omitempty"`
+	ForbiddenGroups    []string `json:"forbiddenGroups,omitempty"`
+}
+
+// Parse parses a YAML or JSON identity policy.
+func Parse(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("parsing identity policy: %w", err)
+	}
+
+	seen := map[uint32]bool{}
+	hasDefault := false
+	for i, rule := range policy.Rules {
+		if rule.KeyID == nil {
+			if hasDefault {
+				return nil, fmt.Errorf("parsing identity policy: rule #%d: only one rule may omit keyID", i)
+			}
+			hasDefault = true
+			continue
+		}
+
+		if seen[*rule.KeyID] {
+			return nil, fmt.Errorf("parsing identity policy: rule #%d: duplicate rule for key %d", i, *rule.KeyID)
+		}
+		seen[*rule.KeyID] = true
+	}
+
+	return policy, nil
+}
+
+// Check returns an error wrapping ErrForbidden if the rule for the key
+// does not allow the username or one of the groups. keyID is ignored
+// unless hasKeyID is set. Without a matching rule, only the reserved
+// prefix is rejected.
+func (p *Policy) Check(keyID uint32, hasKeyID bool, username string, groups []string) error {
+	rule := p.rule(keyID, hasKeyID)
+
+	if !allowed(username, rule.AllowedUsernames, rule.ForbiddenUsernames) {
+		return fmt.Errorf("%w: username %q is not allowed for tokens signed by %s", ErrForbidden, username, keyName(keyID, hasKeyID))
+	}
+
+	for _, group := range groups {
+		if !allowed(group, rule.AllowedGroups, rule.ForbiddenGroups) {
+			return fmt.Errorf("%w: group %q is not allowed for tokens signed by %s", ErrForbidden, group, keyName(keyID, hasKeyID))
+		}
+	}
+
+	return nil
+}
+
+func (p *Policy) rule(keyID uint32, hasKeyID bool) Rule {
+	var fallback Rule
+	for _, rule := range p.Rules {
+		switch {
+		case rule.KeyID == nil:
+			fallback = rule
+		case hasKeyID && *rule.KeyID == keyID:
+			return rule
+		}
+	}
+
+	return fallback
+}
+
+func keyName(keyID uint32, hasKeyID bool) string {
+	if !hasKeyID {
+		return "a key without an ID"
+	}
+	return fmt.Sprintf("key %d", keyID)
+}
+
+func allowed(name string, allowedPatterns, forbiddenPatterns []string) bool {
+	if matchesAny(name, allowedPatterns) {
+		return true
+	}
+
+	if strings.HasPrefix(name, ReservedPrefix) || matchesAny(name, forbiddenPatterns) {
+		return false
+	}
+
+	return len(allowedPatterns) == 0
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+// File is an identity policy file, reloaded when it changes.
+type File struct {
+	path    string
+	loaded  []byte
+	current atomic.Pointer[Policy]
+}
+
+// NewFile loads and validates the identity policy at path.
+func NewFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading identity policy: %w", err)
+	}
+
+	policy, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{path: path, loaded: data}
+	f.current.Store(policy)
+
+	return f, nil
+}
+
+// Watch reloads the policy whenever the file changes, until ctx is
+// cancelled. If the new policy fails to parse, the previous one is kept.
+func (f *File) Watch(ctx context.Context, interval time.Duration) {
+	filewatch.Poll(ctx, f.path, interval, f.loaded, func(data []byte) {
+		policy, err := Parse(data)
+		if err != nil {
+			log.Printf("keeping previous identity policy, new policy is invalid: %v\n", err)
+			return
+		}
+
+		f.current.Store(policy)
+		log.Printf("reloaded identity policy %s\n", f.path)
+	})
+}
+
+// Current returns the most recently loaded valid policy.
+func (f *File) Current() *Policy {
+	return f.current.Load()
+}
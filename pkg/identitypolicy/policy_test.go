@@ -0,0 +1,136 @@
+package identitypolicy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy, err := Parse([]byte(`rules:
+- keyID: 1
+  allowedUsernames: ["ci-*"]
+  allowedGroups: ["system:serviceaccounts", "ci"]
+- keyID: 2
+  forbiddenUsernames: ["admin"]
+  forbiddenGroups: ["admins*"]
+- allowedUsernames: ["jane"]
+`))
+	if err != nil {
+		t.Fatalf("parsing policy: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		keyID     uint32
+		hasKeyID  bool
+		username  string
+		groups    []string
+		wantError bool
+	}{
+		{
+			name:     "allowed by the rule of the key",
+			keyID:    1,
+			hasKeyID: true,
+			username: "ci-builder",
+			groups:   []string{"ci"},
+		},
+		{
+			name:      "not allowed by the rule of the key",
+			keyID:     1,
+			hasKeyID:  true,
+			username:  "jane",
+			wantError: true,
+		},
+		{
+			name:     "reserved group allowed explicitly",
+			keyID:    1,
+			hasKeyID: true,
+			username: "ci-builder",
+			groups:   []string{"system:serviceaccounts"},
+		},
+		{
+			name:      "reserved group not allowed",
+			keyID:     1,
+			hasKeyID:  true,
+			username:  "ci-builder",
+			groups:    []string{"system:masters"},
+			wantError: true,
+		},
+		{
+			name:     "not forbidden by the rule of the key",
+			keyID:    2,
+			hasKeyID: true,
+			username: "jane",
+			groups:   []string{"developers"},
+		},
+		{
+			name:      "forbidden username",
+			keyID:     2,
+			hasKeyID:  true,
+			username:  "admin",
+			wantError: true,
+		},
+		{
+			name:      "forbidden group pattern",
+			keyID:     2,
+			hasKeyID:  true,
+			username:  "jane",
+			groups:    []string{"admins-eu"},
+			wantError: true,
+		},
+		{
+			name:      "reserved username without an allowed pattern",
+			keyID:     2,
+			hasKeyID:  true,
+			username:  "system:admin",
+			wantError: true,
+		},
+		{
+			name:     "other key uses the rule without a key ID",
+			keyID:    3,
+			hasKeyID: true,
+			username: "jane",
+		},
+		{
+			name:      "key without an ID uses the rule without a key ID",
+			keyID:     1,
+			username:  "ci-builder",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.keyID, tt.hasKeyID, tt.username, tt.groups)
+			if tt.wantError {
+				if !errors.Is(err, ErrForbidden) {
+					t.Errorf("got error %v, want ErrForbidden", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestPolicyCheckWithoutRules(t *testing.T) {
+	policy, err := Parse([]byte("rules: []\n"))
+	if err != nil {
+		t.Fatalf("parsing policy: %v", err)
+	}
+
+	if err := policy.Check(0, false, "jane", []string{"developers"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := policy.Check(0, false, "system:admin", nil); !errors.Is(err, ErrForbidden) {
+		t.Errorf("got error %v, want ErrForbidden", err)
+	}
+
+	if err := policy.Check(0, false, "jane", []string{"system:masters"}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("got error %v, want ErrForbidden", err)
+	}
+}
@@ -0,0 +1,66 @@
+package identitypolicy
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// Prefixes are prepended by the authenticator to the usernames and
+// groups carried by tokens, keeping biscuit identities apart from those
+// of other authenticators in RBAC. The identity policy, sealing
+// requirements and tokens themselves use the names without prefixes.
+type Prefixes struct {
+	Username string
+	Group    string
+}
+
+// Apply returns the identity with the prefixes prepended to its username
+// and groups.
+func (p Prefixes) Apply(u user.Info) user.Info {
+	groups := make([]string, 0, len(u.GetGroups()))
+	for _, group := range u.GetGroups() {
+		groups = append(groups, p.Group+group)
+	}
+
+	return &user.DefaultInfo{
+		Name:   p.Username + u.GetName(),
+		UID:    u.GetUID(),
+		Groups: groups,
+		Extra:  u.GetExtra(),
+	}
+}
+
+// Strip returns the identity with the prefixes removed from its username
+// and groups, as carried by the token it was authenticated with. It
+// fails if the username or a group lacks its prefix, as the identity
+// then did not come from a token. system:authenticated, which the API
+// server adds to every authenticated user, is kept as it is.
+func (p Prefixes) Strip(u user.Info) (user.Info, error) {
+	name, ok := strings.CutPrefix(u.GetName(), p.Username)
+	if !ok {
+		return nil, fmt.Errorf("username %q does not have the prefix %q", u.GetName(), p.Username)
+	}
+
+	groups := make([]string, 0, len(u.GetGroups()))
+	for _, group := range u.GetGroups() {
+		if group == user.AllAuthenticated {
+			groups = append(groups, group)
+			continue
+		}
+
+		stripped, ok := strings.CutPrefix(group, p.Group)
+		if !ok {
+			return nil, fmt.Errorf("group %q does not have the prefix %q", group, p.Group)
+		}
+		groups = append(groups, stripped)
+	}
+
+	return &user.DefaultInfo{
+		Name:   name,
+		UID:    u.GetUID(),
+		Groups: groups,
+		Extra:  u.GetExtra(),
+	}, nil
+}
@@ -0,0 +1,76 @@
+package identitypolicy
+
+import (
+	"slices"
+	"testing"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestPrefixesStrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		prefixes   Prefixes
+		user       *user.DefaultInfo
+		wantName   string
+		wantGroups []string
+		wantErr    bool
+	}{
+		{
+			name:       "prefixed",
+			prefixes:   Prefixes{Username: "biscuit:", Group: "biscuit:"},
+			user:       &user.DefaultInfo{Name: "biscuit:jane", Groups: []string{"biscuit:one", user.AllAuthenticated}},
+			wantName:   "jane",
+			wantGroups: []string{"one", user.AllAuthenticated},
+		},
+		{
+			name:       "no prefixes",
+			user:       &user.DefaultInfo{Name: "jane", Groups: []string{"one"}},
+			wantName:   "jane",
+			wantGroups: []string{"one"},
+		},
+		{
+			name:     "username without its prefix",
+			prefixes: Prefixes{Username: "biscuit:", Group: "biscuit:"},
+			user:     &user.DefaultInfo{Name: "jane", Groups: []string{"biscuit:one"}},
+			wantErr:  true,
+		},
+		{
+			name:     "group without its prefix",
+			prefixes: Prefixes{Username: "biscuit:", Group: "biscuit:"},
+			user:     &user.DefaultInfo{Name: "biscuit:jane", Groups: []string{"biscuit:one", "system:masters"}},
+			wantErr:  true,
+		},
+		{
+			name:       "username prefix only",
+			prefixes:   Prefixes{Username: "biscuit:"},
+			user:       &user.DefaultInfo{Name: "biscuit:jane", Groups: []string{"one"}},
+			wantName:   "jane",
+			wantGroups: []string{"one"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.prefixes.Strip(tt.user)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q %q", got.GetName(), got.GetGroups())
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got.GetName() != tt.wantName || !slices.Equal(got.GetGroups(), tt.wantGroups) {
+				t.Errorf("got %q %q, want %q %q", got.GetName(), got.GetGroups(), tt.wantName, tt.wantGroups)
+			}
+
+			if applied := tt.prefixes.Apply(got); applied.GetName() != tt.user.Name {
+				t.Errorf("got %q after applying the prefixes again, want %q", applied.GetName(), tt.user.Name)
+			}
+		})
+	}
+}
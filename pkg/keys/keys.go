@@ -0,0 +1,273 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/biscuit-auth/biscuit-go/v2/pb"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// KeyIDHeader is the PEM header holding the ID of a key, stamped into
+	// the tokens it signs so the verifying key can be found by ID.
+	KeyIDHeader = "Key-ID"
+
+	// AcceptUntilHeader is the PEM header holding the RFC3339 time after
+	// which a public key is no longer trusted to verify tokens.
+	AcceptUntilHeader = "Accept-Until"
+)
+
+// PublicKey is a root public key trusted to verify tokens.
+type PublicKey struct {
+	Key ed25519.PublicKey
+
+	// ID is the key ID, if the key has one.
+	ID    uint32
+	HasID bool
+
+	// AcceptUntil is the time after which the key is no longer trusted.
+	// The zero value trusts the key indefinitely.
+	AcceptUntil time.Time
+
+	Source string
+}
+
+// ParsePublicKey parses a public key file, either the raw 32 byte
+// ed25519 key or a PEM encoded PKIX "PUBLIC KEY" block, whose headers
+// may carry a Key-ID and an Accept-Until time.
+func ParsePublicKey(data []byte) (PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		if len(data) != ed25519.PublicKeySize {
+			return PublicKey{}, fmt.Errorf("expected a PEM block or a %d byte ed25519 key, got %d bytes", ed25519.PublicKeySize, len(data))
+		}
+		return PublicKey{Key: ed25519.PublicKey(data)}, nil
+	}
+
+	if block.Type != "PUBLIC KEY" {
+		return PublicKey{}, fmt.Errorf("unexpected PEM block type %q", block.Type)
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return PublicKey{}, fmt.Errorf("parsing public key: %w", err)
+	}
+
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return PublicKey{}, errors.New("biscuit tokens require an ed25519 public key")
+	}
+
+	pub := PublicKey{Key: key}
+
+	pub.ID, pub.HasID, err = ParseKeyID(block.Headers)
+	if err != nil {
+		return PublicKey{}, err
+	}
+
+	if acceptUntil, ok := block.Headers[AcceptUntilHeader]; ok {
+		pub.AcceptUntil, err = time.Parse(time.RFC3339, acceptUntil)
+		if err != nil {
+			return PublicKey{}, fmt.Errorf("parsing %s header: %w", AcceptUntilHeader, err)
+		}
+	}
+
+	return pub, nil
+}
+
+// ParseKeyID returns the key ID held by the PEM headers, if any.
+func ParseKeyID(headers map[string]string) (uint32, bool, error) {
+	value, ok := headers[KeyIDHeader]
+	if !ok {
+		return 0, false, nil
+	}
+
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, false, fmt.Errorf("parsing %s header: %w", KeyIDHeader, err)
+	}
+
+	return uint32(id), true, nil
+}
+
+// Load loads the public keys at paths. A path may be a key file or a
+// directory, in which case every *.pub file in it is loaded.
+func Load(paths []string) (Set, error) {
+	set := Set{}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading public key file: %w", err)
+		}
+
+		files := []string{path}
+		if info.IsDir() {
+			files, err = filepath.Glob(filepath.Join(path, "*.pub"))
+			if err != nil {
+				return nil, fmt.Errorf("listing public key files: %w", err)
+			}
+			sort.Strings(files)
+		}
+
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("reading public key file: %w", err)
+			}
+
+			key, err := ParsePublicKey(data)
+			if err != nil {
+				return nil, fmt.Errorf("parsing public key file %s: %w", file, err)
+			}
+
+			key.Source = file
+			set = append(set, key)
+		}
+	}
+
+	if len(set) == 0 {
+		return nil, fmt.Errorf("no public keys found in %s", strings.Join(paths, ", "))
+	}
+
+	return set, nil
+}
+
+// Set is a set of trusted root public keys.
+type Set []PublicKey
+
+// Authorizer verifies the token's signatures and returns an authorizer
+// for it. The key whose ID the token names is used; tokens without a key
+// ID, or naming an unknown key, are tried against every key. Keys past
+// their Accept-Until time are ignored.
+func (s Set) Authorizer(token *biscuit.Biscuit, now time.Time, opts ...biscuit.AuthorizerOption) (biscuit.Authorizer, error) {
+	_, authz, err := s.verify(token, now, opts...)
+	return authz, err
+}
+
+// VerifiedAuthorizer is Authorizer, also returning the key that
+// verified the token.
+func (s Set) VerifiedAuthorizer(token *biscuit.Biscuit, now time.Time, opts ...biscuit.AuthorizerOption) (PublicKey, biscuit.Authorizer, error) {
+	return s.verify(token, now, opts...)
+}
+
+// VerifyingKey returns the key that verifies the token's signatures,
+// chosen as by Authorizer.
+func (s Set) VerifyingKey(token *biscuit.Biscuit, now time.Time) (PublicKey, error) {
+	key, _, err := s.verify(token, now)
+	return key, err
+}
+
+func (s Set) verify(token *biscuit.Biscuit, now time.Time, opts ...biscuit.AuthorizerOption) (PublicKey, biscuit.Authorizer, error) {
+	candidates := s.accepted(now)
+
+	serialized, err := token.Serialize()
+	if err != nil {
+		return PublicKey{}, nil, fmt.Errorf("serializing token: %w", err)
+	}
+
+	if id, ok := RootKeyID(serialized); ok {
+		matching := Set{}
+		for _, key := range candidates {
+			if key.HasID && key.ID == id {
+				matching = append(matching, key)
+			}
+		}
+
+		if len(matching) > 0 {
+			candidates = matching
+		} else if s.hasID(id) {
+			return PublicKey{}, nil, fmt.Errorf("root key %d is no longer accepted", id)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return PublicKey{}, nil, errors.New("no trusted public keys")
+	}
+
+	for _, key := range candidates {
+		authz, verifyErr := token.Authorizer(key.Key, opts...)
+		if verifyErr == nil {
+			return key, authz, nil
+		}
+		err = verifyErr
+	}
+
+	return PublicKey{}, nil, err
+}
+
+func (s Set) hasID(id uint32) bool {
+	for _, key := range s {
+		if key.HasID && key.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Set) accepted(now time.Time) Set {
+	accepted := Set{}
+	for _, key := range s {
+		if key.AcceptUntil.IsZero() || !now.After(key.AcceptUntil) {
+			accepted = append(accepted, key)
+		}
+	}
+	return accepted
+}
+
+// RootKeyID returns the root key ID of a serialized token, if it has
+// one, without unmarshalling its blocks.
+func RootKeyID(serialized []byte) (uint32, bool) {
+	const rootKeyIDField protowire.Number = 1
+
+	for len(serialized) > 0 {
+		num, typ, n := protowire.ConsumeTag(serialized)
+		if n < 0 {
+			return 0, false
+		}
+		serialized = serialized[n:]
+
+		if num == rootKeyIDField && typ == protowire.VarintType {
+			id, n := protowire.ConsumeVarint(serialized)
+			if n < 0 {
+				return 0, false
+			}
+			return uint32(id), true
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, serialized)
+		if n < 0 {
+			return 0, false
+		}
+		serialized = serialized[n:]
+	}
+
+	return 0, false
+}
+
+// SetRootKeyID stamps the root key ID into a serialized token. biscuit-go
+// neither sets it nor keeps it when attenuating, so it is set on the
+// serialized token instead. The ID is not signed; it is only a hint for
+// choosing the verifying key.
+func SetRootKeyID(serialized []byte, id uint32) ([]byte, error) {
+	container := &pb.Biscuit{}
+	if err := proto.Unmarshal(serialized, container); err != nil {
+		return nil, fmt.Errorf("unmarshalling token: %w", err)
+	}
+
+	container.RootKeyId = &id
+
+	return proto.Marshal(container)
+}
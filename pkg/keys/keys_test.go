@@ -0,0 +1,128 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+)
+
+// newTestKey returns a key pair, the public key having the given ID.
+func newTestKey(t *testing.T, id uint32, hasID bool, acceptUntil time.Time) (ed25519.PrivateKey, PublicKey) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	return private, PublicKey{Key: public, ID: id, HasID: hasID, AcceptUntil: acceptUntil}
+}
+
+// newTestToken returns a token signed by private, stamped with the root
+// key ID if hasID is set.
+func newTestToken(t *testing.T, private ed25519.PrivateKey, id uint32, hasID bool) *biscuit.Biscuit {
+	t.Helper()
+
+	token, err := biscuit.NewBuilder(private).Build()
+	if err != nil {
+		t.Fatalf("building token: %v", err)
+	}
+
+	serialized, err := token.Serialize()
+	if err != nil {
+		t.Fatalf("serializing token: %v", err)
+	}
+
+	if hasID {
+		serialized, err = SetRootKeyID(serialized, id)
+		if err != nil {
+			t.Fatalf("setting root key ID: %v", err)
+		}
+	}
+
+	token, err = biscuit.Unmarshal(serialized)
+	if err != nil {
+		t.Fatalf("unmarshalling token: %v", err)
+	}
+
+	return token
+}
+
+func TestSetVerify(t *testing.T) {
+	now := time.Now()
+
+	currentPrivate, current := newTestKey(t, 2, true, time.Time{})
+	retiredPrivate, retired := newTestKey(t, 1, true, now.Add(-time.Minute))
+	retiringPrivate, retiring := newTestKey(t, 3, true, now.Add(time.Minute))
+	unnamedPrivate, unnamed := newTestKey(t, 0, false, time.Time{})
+	untrustedPrivate, _ := newTestKey(t, 4, true, time.Time{})
+
+	set := Set{retired, current, retiring, unnamed}
+
+	tests := []struct {
+		name    string
+		token   *biscuit.Biscuit
+		want    PublicKey
+		wantErr string
+	}{
+		{
+			name:  "key selected by ID",
+			token: newTestToken(t, currentPrivate, 2, true),
+			want:  current,
+		},
+		{
+			name:  "key accepted until later",
+			token: newTestToken(t, retiringPrivate, 3, true),
+			want:  retiring,
+		},
+		{
+			name:    "key past its Accept-Until time",
+			token:   newTestToken(t, retiredPrivate, 1, true),
+			wantErr: "root key 1 is no longer accepted",
+		},
+		{
+			name:  "token without a key ID",
+			token: newTestToken(t, unnamedPrivate, 0, false),
+			want:  unnamed,
+		},
+		{
+			name:  "unknown key ID tries every key",
+			token: newTestToken(t, currentPrivate, 7, true),
+			want:  current,
+		},
+		{
+			name:    "key ID naming another key",
+			token:   newTestToken(t, currentPrivate, 3, true),
+			wantErr: "signature",
+		},
+		{
+			name:    "untrusted key",
+			token:   newTestToken(t, untrustedPrivate, 4, true),
+			wantErr: "signature",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := set.VerifyingKey(tt.token, now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("verifying token: %v", err)
+			}
+
+			if !got.Key.Equal(tt.want.Key) {
+				t.Errorf("got key %s, want %s", got.Fingerprint(), tt.want.Fingerprint())
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// PrivateKey is a root private key signing tokens.
+type PrivateKey struct {
+	Key ed25519.PrivateKey
+
+	// ID is the key ID stamped into the tokens the key signs, if the key
+	// has one.
+	ID    uint32
+	HasID bool
+}
+
+// LoadPrivateKey loads a PEM encoded PKCS #8 ed25519 private key, whose
+// headers may carry a Key-ID.
+func LoadPrivateKey(path string) (PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("reading private key from file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return PrivateKey{}, fmt.Errorf("no PEM block found in %s", path)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("parsing private key: %w", err)
+	}
+
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return PrivateKey{}, errors.New("biscuit token generation requires a ed25519 private key")
+	}
+
+	priv := PrivateKey{Key: key}
+
+	priv.ID, priv.HasID, err = ParseKeyID(block.Headers)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+
+	return priv, nil
+}
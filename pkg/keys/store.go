@@ -0,0 +1,150 @@
+package keys
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store holds the trusted public keys, loaded and validated once and
+// swapped atomically when the key files change, so that requests never
+// read the filesystem.
+type Store struct {
+	paths   []string
+	current atomic.Pointer[Set]
+
+	mu       sync.RWMutex
+	loadedAt time.Time
+	lastErr  error
+}
+
+// NewStore loads and validates the public keys at paths.
+func NewStore(paths []string) (*Store, error) {
+	set, err := Load(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{paths: paths, loadedAt: time.Now()}
+	s.current.Store(&set)
+
+	return s, nil
+}
+
+// Current returns the most recently loaded valid keys.
+func (s *Store) Current() Set {
+	return *s.current.Load()
+}
+
+// Watch reloads the keys every interval, until ctx is cancelled. If the
+// keys fail to load, e.g. while a file is being replaced, the previous
+// keys are kept and the error is reported by Status.
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		set, err := Load(s.paths)
+		changed := err == nil && !set.equal(s.Current())
+
+		s.mu.Lock()
+		s.lastErr = err
+		if changed {
+			s.current.Store(&set)
+			s.loadedAt = time.Now()
+		}
+		s.mu.Unlock()
+
+		switch {
+		case err != nil:
+			log.Printf("keeping previous public keys, reloading failed: %v\n", err)
+		case changed:
+			log.Printf("reloaded public keys %v\n", set.Fingerprints())
+		}
+	}
+}
+
+// Status describes the keys currently in use.
+type Status struct {
+	Keys     []KeyStatus `json:"keys"`
+	LoadedAt time.Time   `json:"loadedAt"`
+
+	// ReloadError is the error of the last reload, if it failed.
+	ReloadError string `json:"reloadError,omitempty"`
+}
+
+type KeyStatus struct {
+	Fingerprint string     `json:"fingerprint"`
+	ID          *uint32    `json:"keyID,omitempty"`
+	AcceptUntil *time.Time `json:"acceptUntil,omitempty"`
+	Source      string     `json:"source"`
+}
+
+// Status returns the status of the store.
+func (s *Store) Status() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status := Status{Keys: []KeyStatus{}, LoadedAt: s.loadedAt}
+	if s.lastErr != nil {
+		status.ReloadError = s.lastErr.Error()
+	}
+
+	for _, key := range s.Current() {
+		keyStatus := KeyStatus{Fingerprint: key.Fingerprint(), Source: key.Source}
+		if key.HasID {
+			id := key.ID
+			keyStatus.ID = &id
+		}
+		if !key.AcceptUntil.IsZero() {
+			acceptUntil := key.AcceptUntil
+			keyStatus.AcceptUntil = &acceptUntil
+		}
+		status.Keys = append(status.Keys, keyStatus)
+	}
+
+	return status
+}
+
+// Fingerprint returns the SHA-256 digest of the key.
+func (k PublicKey) Fingerprint() string {
+	sum := sha256.Sum256(k.Key)
+	return "SHA256:" + hex.EncodeToString(sum[:])
+}
+
+// Fingerprints returns the fingerprints of the keys in the set.
+func (s Set) Fingerprints() []string {
+	fingerprints := make([]string, 0, len(s))
+	for _, key := range s {
+		fingerprints = append(fingerprints, key.Fingerprint())
+	}
+	return fingerprints
+}
+
+func (s Set) equal(other Set) bool {
+	if len(s) != len(other) {
+		return false
+	}
+
+	for i := range s {
+		if !s[i].Key.Equal(other[i].Key) ||
+			s[i].ID != other[i].ID ||
+			s[i].HasID != other[i].HasID ||
+			!s[i].AcceptUntil.Equal(other[i].AcceptUntil) ||
+			s[i].Source != other[i].Source {
+			return false
+		}
+	}
+
+	return true
+}
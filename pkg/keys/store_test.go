@@ -0,0 +1,71 @@
+package keys
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreWatch(t *testing.T) {
+	first, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	second, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "biscuit-key.pub")
+	if err := os.WriteFile(path, first, 0o600); err != nil {
+		t.Fatalf("writing public key: %v", err)
+	}
+
+	store, err := NewStore([]string{path})
+	if err != nil {
+		t.Fatalf("loading public key: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.Watch(ctx, time.Millisecond)
+
+	// waitFor polls the store until cond holds.
+	waitFor := func(description string, cond func() bool) {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", description)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("writing public key: %v", err)
+	}
+
+	waitFor("the reload error", func() bool { return store.Status().ReloadError != "" })
+
+	if keys := store.Current(); len(keys) != 1 || !keys[0].Key.Equal(ed25519.PublicKey(first)) {
+		t.Errorf("got keys %v, want the previous key kept", keys.Fingerprints())
+	}
+
+	if err := os.WriteFile(path, second, 0o600); err != nil {
+		t.Fatalf("writing public key: %v", err)
+	}
+
+	waitFor("the new key", func() bool {
+		keys := store.Current()
+		return len(keys) == 1 && keys[0].Key.Equal(ed25519.PublicKey(second))
+	})
+
+	waitFor("the reload error to clear", func() bool { return store.Status().ReloadError == "" })
+}
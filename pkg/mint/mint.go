@@ -0,0 +1,246 @@
+package mint
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/biscuit-auth/biscuit-go/v2/parser"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/everettraven/biscuit/pkg/tokenutil"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+)
+
+// Token describes the authority block of a token to mint.
+type Token struct {
+	// Username and Groups must not contain commas, as the authenticator
+	// splits group facts on them.
+	Username string
+	UID      string
+	Groups   []string
+
+	// Extra is carried as k8s:userinfo:extra(key, value) facts and
+	// returned as the user's extra attributes on authentication. Keys
+	// with a ReservedExtraPrefixes prefix are rejected.
+	Extra map[string][]string
+
+	// BoundExtra is carried like Extra, but holds the pod binding of the
+	// ServiceAccount token a token was exchanged for, under BoundExtraPrefix
+	// keys. It is only allowed for ServiceAccount usernames and must
+	// never be set from user input.
+	BoundExtra map[string][]string
+
+	// Grants are used by the webhook in grant mode.
+	Grants []Grant
+
+	// Audiences, if set, restrict the token to TokenReviews for one of
+	// them.
+	Audiences []string
+
+	// Checks are added to the authority block, e.g. to bound the
+	// token's lifetime.
+	Checks []biscuit.Check
+}
+
+// Grant is a k8s:grant(api_group, resource, subresource, verb, namespace)
+// fact. "*" matches any value. An API group of "" matches the core group,
+// a subresource of "" matches requests for the main resource only and a
+// namespace of "" matches cluster-scoped requests.
+type Grant struct {
+	APIGroup    string
+	Resource    string
+	Subresource string
+	Verb        string
+	Namespace   string
+}
+
+// ParseGrant parses a grant in the form
+// RESOURCE[.GROUP][/SUBRESOURCE]:VERB[:NAMESPACE]. An omitted group is the
+// core group, an omitted subresource only matches the main resource and
+// an omitted namespace matches any namespace.
+func ParseGrant(grant string) (Grant, error) {
+	parts := strings.Split(grant, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Grant{}, fmt.Errorf("invalid grant %q: expected RESOURCE[.GROUP][/SUBRESOURCE]:VERB[:NAMESPACE]", grant)
+	}
+
+	resource, subresource, _ := strings.Cut(parts[0], "/")
+	resource, group, _ := strings.Cut(resource, ".")
+
+	namespace := "*"
+	if len(parts) == 3 {
+		namespace = parts[2]
+	}
+
+	return Grant{
+		APIGroup:    group,
+		Resource:    resource,
+		Subresource: subresource,
+		Verb:        parts[1],
+		Namespace:   namespace,
+	}, nil
+}
+
+// Mint signs the token with the key, stamping the key's ID into it, and
+// returns it base64 encoded.
+func (t Token) Mint(key keys.PrivateKey) (string, error) {
+	if err := ValidateIdentity(t.Username, t.Groups); err != nil {
+		return "", err
+	}
+
+	if err := ValidateExtra(t.Extra); err != nil {
+		return "", err
+	}
+
+	if err := validateBoundExtra(t.Username, t.BoundExtra); err != nil {
+		return "", err
+	}
+
+	var authorityBlock strings.Builder
+
+	authorityBlock.WriteString(fmt.Sprintf("k8s:userinfo:username(%q);\n", t.Username))
+
+	if t.UID != "" {
+		authorityBlock.WriteString(fmt.Sprintf("k8s:userinfo:uid(%q);\n", t.UID))
+	}
+
+	for _, group := range t.Groups {
+		authorityBlock.WriteString(fmt.Sprintf("k8s:userinfo:group(%q);\n", group))
+	}
+
+	for _, extra := range []map[string][]string{t.Extra, t.BoundExtra} {
+		for _, key := range slices.Sorted(maps.Keys(extra)) {
+			for _, value := range extra[key] {
+				authorityBlock.WriteString(fmt.Sprintf("k8s:userinfo:extra(%q, %q);\n", key, value))
+			}
+		}
+	}
+
+	for _, grant := range t.Grants {
+		authorityBlock.WriteString(fmt.Sprintf("k8s:grant(%q, %q, %q, %q, %q);\n", grant.APIGroup, grant.Resource, grant.Subresource, grant.Verb, grant.Namespace))
+	}
+
+	authority, err := parser.FromStringBlock(authorityBlock.String())
+	if err != nil {
+		return "", fmt.Errorf("parsing authority block: %w", err)
+	}
+
+	builder := biscuit.NewBuilder(key.Key)
+
+	err = builder.AddBlock(authority)
+	if err != nil {
+		return "", fmt.Errorf("adding authority block: %w", err)
+	}
+
+	checks := t.Checks
+	if len(t.Audiences) > 0 {
+		audienceCheck, err := tokenutil.AudienceCheck(t.Audiences)
+		if err != nil {
+			return "", fmt.Errorf("parsing audience check: %w", err)
+		}
+
+		checks = append([]biscuit.Check{audienceCheck}, checks...)
+	}
+
+	for _, check := range checks {
+		err = builder.AddAuthorityCheck(check)
+		if err != nil {
+			return "", fmt.Errorf("adding check: %w", err)
+		}
+	}
+
+	b, err := builder.Build()
+	if err != nil {
+		return "", fmt.Errorf("failed to build biscuit: %v", err)
+	}
+
+	token, err := b.Serialize()
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize biscuit: %v", err)
+	}
+
+	if key.HasID {
+		token, err = keys.SetRootKeyID(token, key.ID)
+		if err != nil {
+			return "", fmt.Errorf("setting root key ID: %w", err)
+		}
+	}
+
+	return base64.URLEncoding.EncodeToString(token), nil
+}
+
+// ValidateIdentity rejects usernames and groups containing commas. The
+// authenticator splits group facts on commas, so a group such as
+// "dev,system:masters" would otherwise authenticate as two groups.
+func ValidateIdentity(username string, groups []string) error {
+	if strings.Contains(username, ",") {
+		return fmt.Errorf("username %q must not contain a comma", username)
+	}
+
+	for _, group := range groups {
+		if strings.Contains(group, ",") {
+			return fmt.Errorf("group %q must not contain a comma", group)
+		}
+	}
+
+	return nil
+}
+
+// ReservedExtraPrefixes are the prefixes of the extra keys set by
+// Kubernetes, such as the pod binding of ServiceAccount tokens, and by
+// the webhook, such as tokencache.ExtraKey. Kubernetes components trust
+// them, so tokens may not carry them, except for BoundExtraPrefix keys
+// of ServiceAccount tokens.
+var ReservedExtraPrefixes = []string{"authentication.kubernetes.io/", "everettraven.github.io/"}
+
+// BoundExtraPrefix is the prefix of the extra keys describing the pod and
+// node a ServiceAccount token is bound to, and its credential ID.
+const BoundExtraPrefix = "authentication.kubernetes.io/"
+
+// IsReservedExtraKey reports whether the extra key has one of the
+// ReservedExtraPrefixes.
+func IsReservedExtraKey(key string) bool {
+	return slices.ContainsFunc(ReservedExtraPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
+
+// IsBoundExtraKey reports whether a token for username may carry the
+// reserved extra key, which is only the case for BoundExtraPrefix keys
+// of ServiceAccounts.
+func IsBoundExtraKey(username, key string) bool {
+	_, _, err := serviceaccount.SplitUsername(username)
+	return err == nil && strings.HasPrefix(key, BoundExtraPrefix)
+}
+
+// ValidateExtra rejects empty extra keys and reserved keys, which are
+// set by Kubernetes and the webhook.
+func ValidateExtra(extra map[string][]string) error {
+	for key := range extra {
+		if key == "" {
+			return errors.New("extra keys must not be empty")
+		}
+
+		if IsReservedExtraKey(key) {
+			return fmt.Errorf("extra key %q is reserved by Kubernetes or the webhook", key)
+		}
+	}
+
+	return nil
+}
+
+// validateBoundExtra rejects bound extras for users other than
+// ServiceAccounts and keys other than BoundExtraPrefix ones.
+func validateBoundExtra(username string, extra map[string][]string) error {
+	for key := range extra {
+		if !IsBoundExtraKey(username, key) {
+			return fmt.Errorf("bound extra key %q is not allowed for user %q", key, username)
+		}
+	}
+
+	return nil
+}
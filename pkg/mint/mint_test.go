@@ -0,0 +1,135 @@
+package mint
+
+import (
+	"testing"
+)
+
+func TestParseGrant(t *testing.T) {
+	tests := []struct {
+		grant   string
+		want    Grant
+		wantErr bool
+	}{
+		{
+			grant: "pods:get",
+			want:  Grant{Resource: "pods", Verb: "get", Namespace: "*"},
+		},
+		{
+			grant: "pods/exec:create:one",
+			want:  Grant{Resource: "pods", Subresource: "exec", Verb: "create", Namespace: "one"},
+		},
+		{
+			grant: "pods.metrics.k8s.io:list",
+			want:  Grant{APIGroup: "metrics.k8s.io", Resource: "pods", Verb: "list", Namespace: "*"},
+		},
+		{
+			grant: "deployments.apps/scale:update:",
+			want:  Grant{APIGroup: "apps", Resource: "deployments", Subresource: "scale", Verb: "update", Namespace: ""},
+		},
+		{
+			grant: "*.*/*:*",
+			want:  Grant{APIGroup: "*", Resource: "*", Subresource: "*", Verb: "*", Namespace: "*"},
+		},
+		{grant: "pods", wantErr: true},
+		{grant: "pods:get:one:two", wantErr: true},
+		{grant: ":get", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.grant, func(t *testing.T) {
+			got, err := ParseGrant(tt.grant)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateIdentity(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		groups   []string
+		wantErr  bool
+	}{
+		{name: "plain identity", username: "jane", groups: []string{"dev", "system:masters"}},
+		{name: "comma in username", username: "jane,bob", wantErr: true},
+		{name: "comma in group", username: "jane", groups: []string{"dev,system:masters"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateIdentity(tt.username, tt.groups)
+			if tt.wantErr && err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateExtra(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{key: "team"},
+		{key: "example.com/team"},
+		{key: "", wantErr: true},
+		{key: "everettraven.github.io/biscuit-token-digest", wantErr: true},
+		{key: "everettraven.github.io/biscuit", wantErr: true},
+		{key: "authentication.kubernetes.io/pod-name", wantErr: true},
+		{key: "authentication.kubernetes.io/pod-uid", wantErr: true},
+		{key: "authentication.kubernetes.io/node-name", wantErr: true},
+		{key: "authentication.kubernetes.io/credential-id", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			err := ValidateExtra(map[string][]string{tt.key: {"value"}})
+			if tt.wantErr && err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestIsBoundExtraKey(t *testing.T) {
+	tests := []struct {
+		username string
+		key      string
+		want     bool
+	}{
+		{username: "system:serviceaccount:ci:builder", key: "authentication.kubernetes.io/pod-name", want: true},
+		{username: "system:serviceaccount:ci:builder", key: "authentication.kubernetes.io/credential-id", want: true},
+		{username: "system:serviceaccount:ci:builder", key: "everettraven.github.io/biscuit-token-digest"},
+		{username: "system:serviceaccount:ci:builder", key: "team"},
+		{username: "jane", key: "authentication.kubernetes.io/pod-name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.username+"/"+tt.key, func(t *testing.T) {
+			if got := IsBoundExtraKey(tt.username, tt.key); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package revocation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/everettraven/biscuit/pkg/filewatch"
+)
+
+// ErrRevoked is wrapped by the errors reporting a revoked token.
+var ErrRevoked = errors.New("token has been revoked")
+
+// List is a revocation list file holding one hex encoded revocation ID
+// per line. Blank lines and lines starting with '#' are ignored.
+type List struct {
+	path    string
+	loaded  []byte
+	current atomic.Pointer[map[string]struct{}]
+}
+
+// NewList loads the revocation list at path. A missing file is treated
+// as an empty list, so that it can be created by the first revocation.
+func NewList(path string) (*List, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading revocation list: %w", err)
+	}
+
+	ids, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &List{path: path, loaded: data}
+	l.current.Store(&ids)
+
+	return l, nil
+}
+
+// Watch reloads the list whenever the file changes, until ctx is
+// cancelled. If the new list fails to parse, the previous one is kept.
+func (l *List) Watch(ctx context.Context, interval time.Duration) {
+	filewatch.Poll(ctx, l.path, interval, l.loaded, func(data []byte) {
+		ids, err := Parse(data)
+		if err != nil {
+			log.Printf("keeping previous revocation list, new list is invalid: %v\n", err)
+			return
+		}
+
+		l.current.Store(&ids)
+		log.Printf("reloaded revocation list %s, %d revoked IDs\n", l.path, len(ids))
+	})
+}
+
+// Check returns an error wrapping ErrRevoked if any block of the token
+// has been revoked. Revoking a block revokes every token derived from
+// it, but not the tokens it was derived from.
+func (l *List) Check(b *biscuit.Biscuit) error {
+	ids := *l.current.Load()
+
+	for i, id := range b.RevocationIds() {
+		if _, ok := ids[hex.EncodeToString(id)]; ok {
+			return fmt.Errorf("%w: block #%d is revoked", ErrRevoked, i)
+		}
+	}
+
+	return nil
+}
+
+// Parse parses the contents of a revocation list.
+func Parse(data []byte) (map[string]struct{}, error) {
+	ids := map[string]struct{}{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		id := strings.TrimSpace(scanner.Text())
+		if id == "" || strings.HasPrefix(id, "#") {
+			continue
+		}
+
+		if _, err := hex.DecodeString(id); err != nil {
+			return nil, fmt.Errorf("parsing revocation list line %d: %w", line, err)
+		}
+
+		ids[strings.ToLower(id)] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading revocation list: %w", err)
+	}
+
+	return ids, nil
+}
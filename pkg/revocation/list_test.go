@@ -0,0 +1,87 @@
+package revocation
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+)
+
+func TestListCheck(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	root, err := biscuit.NewBuilder(private).Build()
+	if err != nil {
+		t.Fatalf("building token: %v", err)
+	}
+
+	attenuated, err := root.Append(rand.Reader, root.CreateBlock().Build())
+	if err != nil {
+		t.Fatalf("appending block: %v", err)
+	}
+
+	further, err := attenuated.Append(rand.Reader, attenuated.CreateBlock().Build())
+	if err != nil {
+		t.Fatalf("appending block: %v", err)
+	}
+
+	// Revoking the first attenuation block revokes the tokens derived
+	// from it, but not the root token.
+	revoked := hex.EncodeToString(attenuated.RevocationIds()[1])
+
+	tests := []struct {
+		name        string
+		token       *biscuit.Biscuit
+		wantRevoked string
+	}{
+		{
+			name:  "parent token",
+			token: root,
+		},
+		{
+			name:        "token with the revoked block",
+			token:       attenuated,
+			wantRevoked: "block #1 is revoked",
+		},
+		{
+			name:        "token derived from the revoked block",
+			token:       further,
+			wantRevoked: "block #1 is revoked",
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "revocation-list")
+	if err := os.WriteFile(path, []byte("# revoked attenuation\n"+strings.ToUpper(revoked)+"\n\n"), 0o600); err != nil {
+		t.Fatalf("writing revocation list: %v", err)
+	}
+
+	list, err := NewList(path)
+	if err != nil {
+		t.Fatalf("loading revocation list: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := list.Check(tt.token)
+			if tt.wantRevoked == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrRevoked) || !strings.Contains(err.Error(), tt.wantRevoked) {
+				t.Errorf("got error %v, want %q", err, tt.wantRevoked)
+			}
+		})
+	}
+}
@@ -1,11 +1,20 @@
 package server
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"time"
 
 	localauthenticator "github.com/everettraven/biscuit/pkg/authenticator"
 	localauthorizer "github.com/everettraven/biscuit/pkg/authorizer"
+	"github.com/everettraven/biscuit/pkg/exchange"
 	"github.com/everettraven/biscuit/pkg/handlers"
+	"github.com/everettraven/biscuit/pkg/identitypolicy"
+	"github.com/everettraven/biscuit/pkg/keys"
+	"github.com/everettraven/biscuit/pkg/revocation"
+	"github.com/everettraven/biscuit/pkg/tokencache"
+	"github.com/everettraven/biscuit/pkg/tokenutil"
 	"github.com/spf13/pflag"
 	"k8s.io/apiserver/pkg/authentication/authenticator"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
@@ -19,22 +28,217 @@ type Instance struct {
 	addr               string
 	tokenAuthenticator authenticator.Token
 	authorizer         authorizer.Authorizer
-	publicKeyFile      string
+	publicKeyFiles     []string
+	clockSkew          time.Duration
+	grantMode          bool
+	carryThrough       bool
+	verboseReasons     bool
+	logWorld           bool
+	policyFile         string
+	revocationList     string
+	identityPolicy     string
+	sealedUsers        []string
+	sealedGroups       []string
+	apiAudiences       []string
+	prefixes           identitypolicy.Prefixes
+	reloadInterval     time.Duration
+	limits             tokenutil.Limits
+	tokenCacheTTL      time.Duration
+	tokenCacheSize     int
+	attenuateEndpoint  bool
+	privateKeyFile     string
+	oidc               exchange.OIDCConfig
+	oidcJWKSFile       string
+	saExchange         bool
+	saKubeconfig       string
+	saAudiences        []string
 }
 
 func (i *Instance) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&i.addr, "addr", "0.0.0.0:8080", "specifies the address in which the server should listen for incoming requests")
-	fs.StringVar(&i.publicKeyFile, "public-key-file", "biscuit-key.pub", "path to file containing public key for verification of biscuit tokens")
+	fs.StringArrayVar(&i.publicKeyFiles, "public-key-file", []string{"biscuit-key.pub"}, "path to a public key file, or a directory of *.pub files, trusted to verify biscuit tokens. May be repeated to trust several keys")
+	fs.BoolVar(&i.grantMode, "grant-mode", false, "allow requests granted by k8s:grant facts in the authority block of a token instead of only restricting them")
+	fs.BoolVar(&i.carryThrough, "impersonation-carry-through", false, "apply the checks of a token to the requests of the identities its holder impersonates, when the holder impersonates the token digest user extra with their own token's digest. That impersonation must itself pass the token's checks and be allowed by RBAC or a grant")
+	fs.BoolVar(&i.verboseReasons, "verbose-reasons", false, "explain denials in the SubjectAccessReview reason with the failed checks and the matching deny policy, and log them. Re-evaluates denied requests")
+	fs.BoolVar(&i.logWorld, "verbose-reasons-world", false, "with --verbose-reasons, also log the Datalog world denied requests were evaluated in, which holds every fact of the token including its identity and extras")
+	fs.StringVar(&i.policyFile, "policy-file", "", "path to file containing a Datalog policy added to every authorization. It is reloaded when it changes")
+	fs.StringVar(&i.prefixes.Username, "username-prefix", "", "prefix prepended to the usernames of biscuit identities, e.g. biscuit:, keeping them apart from other users in RBAC")
+	fs.StringVar(&i.prefixes.Group, "group-prefix", "", "prefix prepended to the groups of biscuit identities, e.g. biscuit:, keeping them apart from other groups in RBAC")
+	fs.StringVar(&i.identityPolicy, "identity-policy-file", "", "path to file restricting the usernames and groups tokens may carry, per signing key. When set, system: usernames and groups are rejected unless allowed. It is reloaded when it changes")
+	fs.StringVar(&i.revocationList, "revocation-list", "", "path to file listing the hex encoded revocation IDs of revoked tokens, one per line. It is reloaded when it changes")
+	fs.StringArrayVar(&i.sealedUsers, "require-sealed-user", []string{}, "user that must authenticate with a sealed token, which cannot be attenuated further. May be repeated")
+	fs.StringArrayVar(&i.sealedGroups, "require-sealed-group", []string{}, "group whose members must authenticate with a sealed token, which cannot be attenuated further. May be repeated")
+	fs.StringArrayVar(&i.apiAudiences, "api-audience", []string{}, "audience tokens are authenticated for when a TokenReview specifies none, as the API server's --api-audiences. May be repeated")
+	fs.DurationVar(&i.reloadInterval, "reload-interval", 10*time.Second, "how often watched files are checked for changes")
+	fs.DurationVar(&i.clockSkew, "clock-skew", 0, "clock skew tolerated when evaluating token expiry and not-before times")
+	fs.DurationVar(&i.tokenCacheTTL, "token-cache-ttl", 10*time.Minute, "how long an authenticated token is kept for authorization. Must be longer than the API server's authentication cache TTL")
+	fs.IntVar(&i.tokenCacheSize, "token-cache-max-entries", 100000, "maximum number of authenticated tokens kept for authorization. When full, the token authenticated the longest ago is evicted and must be authenticated again. 0 disables the limit")
+	fs.IntVar(&i.limits.MaxTokenBytes, "max-token-bytes", 16384, "maximum size of a decoded token, in bytes. 0 disables the limit")
+	fs.IntVar(&i.limits.MaxBlocks, "max-token-blocks", 32, "maximum number of blocks in a token, including the authority block. 0 disables the limit")
+	fs.IntVar(&i.limits.MaxFacts, "max-facts", 0, "maximum number of facts generated when evaluating a token. 0 keeps the biscuit-go default of 1000")
+	fs.IntVar(&i.limits.MaxIterations, "max-iterations", 0, "maximum number of Datalog iterations when evaluating a token. 0 keeps the biscuit-go default of 100")
+	fs.DurationVar(&i.limits.MaxEvaluationTime, "max-evaluation-time", 0, "maximum time spent evaluating a token. 0 keeps the biscuit-go default of 2ms")
+	fs.BoolVar(&i.attenuateEndpoint, "attenuate-endpoint", false, "serve /attenuate, which attenuates tokens signed by a trusted key as requested")
+	fs.StringVar(&i.privateKeyFile, "private-key-file", "", "path to the private key signing the tokens minted by the /exchange endpoints")
+	fs.StringVar(&i.oidc.Issuer, "oidc-issuer", "", "issuer whose ID tokens /exchange exchanges for biscuit tokens. Enables /exchange")
+	fs.StringVar(&i.oidc.Audience, "oidc-audience", "", "audience ID tokens must be issued for to be exchanged")
+	fs.StringVar(&i.oidcJWKSFile, "oidc-jwks-file", "", "path to the JSON Web Key Set verifying ID tokens. It is reloaded when it changes")
+	fs.StringVar(&i.oidc.UsernameClaim, "oidc-username-claim", "sub", "ID token claim mapped to the username of exchanged tokens")
+	fs.StringVar(&i.oidc.GroupsClaim, "oidc-groups-claim", "groups", "ID token claim mapped to the groups of exchanged tokens")
+	fs.StringVar(&i.oidc.UsernamePrefix, "oidc-username-prefix", "", "prefix prepended to the usernames of exchanged tokens. Defaults to the issuer followed by '#', or no prefix when the username claim is email. '-' disables it")
+	fs.StringVar(&i.oidc.GroupsPrefix, "oidc-groups-prefix", "", "prefix prepended to the groups of exchanged tokens. Defaults to the issuer followed by '#'. '-' disables it")
+	fs.BoolVar(&i.saExchange, "serviceaccount-exchange", false, "serve /exchange/serviceaccount, which exchanges ServiceAccount tokens reviewed by the API server for biscuit tokens")
+	fs.StringVar(&i.saKubeconfig, "serviceaccount-kubeconfig", "", "path to a kubeconfig for the API server reviewing ServiceAccount tokens. Defaults to the cluster the webhook runs in")
+	fs.StringArrayVar(&i.saAudiences, "serviceaccount-audience", []string{}, "audience ServiceAccount tokens must be issued for to be exchanged. May be repeated. Defaults to the API server's audiences")
+	fs.DurationVar(&i.oidc.TTL, "exchange-ttl", time.Hour, "maximum lifetime of exchanged tokens. They never outlive the token they were exchanged for")
 }
 
 func (i *Instance) Serve() error {
 	mux := http.NewServeMux()
 
-	i.tokenAuthenticator = localauthenticator.NewBiscuit(i.publicKeyFile)
-	i.authorizer = localauthorizer.NewBiscuit(i.publicKeyFile)
+	publicKeys, err := keys.NewStore(i.publicKeyFiles)
+	if err != nil {
+		return fmt.Errorf("loading public keys: %w", err)
+	}
+	go publicKeys.Watch(context.Background(), i.reloadInterval)
+
+	cache := tokencache.New(i.tokenCacheTTL, tokencache.WithMaxEntries(i.tokenCacheSize))
+
+	authorizerOpts := []localauthorizer.Option{
+		localauthorizer.WithClockSkew(i.clockSkew),
+		localauthorizer.WithLimits(i.limits),
+		localauthorizer.WithGrantMode(i.grantMode),
+		localauthorizer.WithImpersonationCarryThrough(i.carryThrough),
+		localauthorizer.WithPrefixes(i.prefixes),
+	}
+
+	if i.policyFile != "" {
+		policy, err := localauthorizer.NewPolicyFile(i.policyFile)
+		if err != nil {
+			return fmt.Errorf("loading policy file: %w", err)
+		}
+		go policy.Watch(context.Background(), i.reloadInterval)
+
+		authorizerOpts = append(authorizerOpts, localauthorizer.WithPolicyFile(policy))
+	}
+
+	authenticatorOpts := []localauthenticator.Option{
+		localauthenticator.WithClockSkew(i.clockSkew),
+		localauthenticator.WithLimits(i.limits),
+		localauthenticator.WithRequireSealed(i.sealedUsers, i.sealedGroups),
+		localauthenticator.WithImplicitAudiences(i.apiAudiences),
+		localauthenticator.WithPrefixes(i.prefixes),
+	}
+
+	if i.revocationList != "" {
+		revocations, err := revocation.NewList(i.revocationList)
+		if err != nil {
+			return fmt.Errorf("loading revocation list: %w", err)
+		}
+		go revocations.Watch(context.Background(), i.reloadInterval)
+
+		authenticatorOpts = append(authenticatorOpts, localauthenticator.WithRevocationList(revocations))
+		authorizerOpts = append(authorizerOpts, localauthorizer.WithRevocationList(revocations))
+	}
+
+	var identityPolicy *identitypolicy.File
+	if i.identityPolicy != "" {
+		identityPolicy, err = identitypolicy.NewFile(i.identityPolicy)
+		if err != nil {
+			return fmt.Errorf("loading identity policy: %w", err)
+		}
+		go identityPolicy.Watch(context.Background(), i.reloadInterval)
+
+		authenticatorOpts = append(authenticatorOpts, localauthenticator.WithIdentityPolicy(identityPolicy))
+	}
+
+	i.tokenAuthenticator = localauthenticator.NewBiscuit(publicKeys, cache, authenticatorOpts...)
+	biscuitAuthorizer := localauthorizer.NewBiscuit(publicKeys, cache, authorizerOpts...)
+	i.authorizer = biscuitAuthorizer
+
+	authorizeOpts := []handlers.AuthorizeOption{}
+	if i.verboseReasons {
+		authorizeOpts = append(authorizeOpts, handlers.WithVerboseReasons(biscuitAuthorizer), handlers.WithWorldLogging(i.logWorld))
+	}
 
 	mux.Handle("/authenticate", handlers.NewAuthenticate(i.tokenAuthenticator))
-	mux.Handle("/authorize", handlers.NewAuthorize(i.authorizer))
+	mux.Handle("/authorize", handlers.NewAuthorize(i.authorizer, authorizeOpts...))
+	mux.Handle("/status", handlers.NewStatus(publicKeys))
+
+	if i.attenuateEndpoint {
+		mux.Handle("/attenuate", handlers.NewAttenuate(publicKeys, i.limits))
+	}
+
+	if i.oidc.Issuer != "" {
+		oidc, err := i.oidcExchanger()
+		if err != nil {
+			return err
+		}
+
+		mux.Handle("/exchange", handlers.NewExchange(oidc))
+	}
+
+	if i.saExchange {
+		sa, err := i.serviceAccountExchanger(identityPolicy)
+		if err != nil {
+			return err
+		}
+
+		mux.Handle("/exchange/serviceaccount", handlers.NewExchange(sa))
+	}
 
 	return http.ListenAndServe(i.addr, mux)
 }
+
+func (i *Instance) signingKey() (keys.PrivateKey, error) {
+	if i.privateKeyFile == "" {
+		return keys.PrivateKey{}, fmt.Errorf("--private-key-file is required to exchange tokens")
+	}
+
+	key, err := keys.LoadPrivateKey(i.privateKeyFile)
+	if err != nil {
+		return keys.PrivateKey{}, fmt.Errorf("loading private key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (i *Instance) oidcExchanger() (*exchange.OIDC, error) {
+	key, err := i.signingKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if i.oidcJWKSFile == "" {
+		return nil, fmt.Errorf("--oidc-jwks-file is required to exchange ID tokens")
+	}
+
+	keySet, err := exchange.NewJWKSFile(i.oidcJWKSFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading JWKS file: %w", err)
+	}
+	go keySet.Watch(context.Background(), i.reloadInterval)
+
+	config := i.oidc
+	config.ClockSkew = i.clockSkew
+
+	return exchange.NewOIDC(config, keySet, key)
+}
+
+func (i *Instance) serviceAccountExchanger(identityPolicy *identitypolicy.File) (*exchange.ServiceAccount, error) {
+	key, err := i.signingKey()
+	if err != nil {
+		return nil, err
+	}
+
+	reviewer, err := exchange.NewTokenReviewer(i.saKubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return exchange.NewServiceAccount(exchange.ServiceAccountConfig{
+		Audiences:      i.saAudiences,
+		TTL:            i.oidc.TTL,
+		IdentityPolicy: identityPolicy,
+	}, reviewer, key)
+}
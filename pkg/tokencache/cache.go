@@ -0,0 +1,139 @@
+package tokencache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// ExtraKey is the user extra key under which the authenticator exposes
+// the digest of a verified token, for the authorizer to look it up.
+const ExtraKey = "everettraven.github.io/biscuit-token-digest"
+
+// Digest identifies a token by the SHA-256 digest of its revocation IDs,
+// which differ for every block, so an attenuated token never shares a
+// digest with its parent.
+func Digest(b *biscuit.Biscuit) string {
+	h := sha256.New()
+	for _, id := range b.RevocationIds() {
+		h.Write(id)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Cache holds verified tokens in memory, keyed by their Digest, so that
+// the raw token never leaves the webhook. Entries expire ttl after the
+// token was last authenticated.
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu        sync.RWMutex
+	entries   map[string]entry
+	lastSweep time.Time
+}
+
+// Entry is a verified token along with the identity it carries, without
+// prefixes, and the audiences it authenticated for.
+type Entry struct {
+	Token     string
+	User      user.Info
+	Audiences []string
+}
+
+type entry struct {
+	Entry
+	expires time.Time
+}
+
+func New(ttl time.Duration, opts ...Option) *Cache {
+	c := &Cache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]entry{},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+type Option func(*Cache)
+
+// WithMaxEntries bounds the number of tokens held. When full, expired
+// entries are removed, then the entry expiring soonest is evicted, so
+// its token must be authenticated again before it is authorized.
+func WithMaxEntries(maxEntries int) Option {
+	return func(c *Cache) {
+		c.maxEntries = maxEntries
+	}
+}
+
+// Put stores the base64 encoded token, parsed as b, along with the user
+// and audiences it authenticated, and returns the digest it can be
+// looked up with.
+func (c *Cache) Put(token string, b *biscuit.Biscuit, u user.Info, audiences []string) string {
+	digest := Digest(b)
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, exists := c.entries[digest]
+	full := !exists && c.maxEntries > 0 && len(c.entries) >= c.maxEntries
+
+	if full || now.Sub(c.lastSweep) > c.ttl {
+		c.sweep(now)
+	}
+
+	if full && len(c.entries) >= c.maxEntries {
+		c.evictSoonest()
+	}
+
+	c.entries[digest] = entry{Entry: Entry{Token: token, User: u, Audiences: audiences}, expires: now.Add(c.ttl)}
+
+	return digest
+}
+
+// sweep removes the expired entries. c.mu must be held.
+func (c *Cache) sweep(now time.Time) {
+	for key, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+	c.lastSweep = now
+}
+
+// evictSoonest removes the entry expiring soonest, i.e. the one
+// authenticated the longest ago. c.mu must be held.
+func (c *Cache) evictSoonest() {
+	var soonest string
+	var expires time.Time
+	for key, e := range c.entries {
+		if soonest == "" || e.expires.Before(expires) {
+			soonest, expires = key, e.expires
+		}
+	}
+	delete(c.entries, soonest)
+}
+
+// Get returns the entry stored under digest.
+func (c *Cache) Get(digest string) (Entry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	e, ok := c.entries[digest]
+	if !ok || c.now().After(e.expires) {
+		return Entry{}, false
+	}
+
+	return e.Entry, true
+}
@@ -0,0 +1,107 @@
+package tokencache
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// newTestToken returns a new token, with revocation IDs, and so a
+// digest, of its own.
+func newTestToken(t *testing.T) *biscuit.Biscuit {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	token, err := biscuit.NewBuilder(private).Build()
+	if err != nil {
+		t.Fatalf("building token: %v", err)
+	}
+
+	return token
+}
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	cache := New(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	token := newTestToken(t)
+	digest := cache.Put("token", token, &user.DefaultInfo{Name: "jane"}, []string{"biscuit"})
+
+	if digest != Digest(token) {
+		t.Errorf("got digest %q, want %q", digest, Digest(token))
+	}
+
+	got, ok := cache.Get(digest)
+	if !ok {
+		t.Fatal("expected the token to be cached")
+	}
+
+	if got.Token != "token" || got.User.GetName() != "jane" || len(got.Audiences) != 1 || got.Audiences[0] != "biscuit" {
+		t.Errorf("got entry %+v", got)
+	}
+
+	if _, ok := cache.Get(Digest(newTestToken(t))); ok {
+		t.Error("got an entry for a token that was never cached")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := cache.Get(digest); !ok {
+		t.Error("expected the token to be cached until its TTL elapses")
+	}
+
+	now = now.Add(time.Second)
+	if _, ok := cache.Get(digest); ok {
+		t.Error("expected the token to expire after its TTL")
+	}
+
+	cache.Put("other", newTestToken(t), &user.DefaultInfo{Name: "john"}, nil)
+	if _, ok := cache.entries[digest]; ok {
+		t.Error("expected the expired token to be swept")
+	}
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	now := time.Now()
+	cache := New(time.Minute, WithMaxEntries(2))
+	cache.now = func() time.Time { return now }
+
+	firstToken := newTestToken(t)
+	first := cache.Put("first", firstToken, &user.DefaultInfo{Name: "jane"}, nil)
+	now = now.Add(time.Second)
+	second := cache.Put("second", newTestToken(t), &user.DefaultInfo{Name: "jane"}, nil)
+	now = now.Add(time.Second)
+
+	// Authenticating the first token again makes the second the one
+	// expiring soonest, and does not evict anything.
+	cache.Put("first", firstToken, &user.DefaultInfo{Name: "jane"}, nil)
+	if len(cache.entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(cache.entries))
+	}
+
+	third := cache.Put("third", newTestToken(t), &user.DefaultInfo{Name: "jane"}, nil)
+	if len(cache.entries) != 2 {
+		t.Errorf("got %d entries, want 2", len(cache.entries))
+	}
+
+	for name, tt := range map[string]struct {
+		digest string
+		want   bool
+	}{
+		"first":  {digest: first, want: true},
+		"second": {digest: second, want: false},
+		"third":  {digest: third, want: true},
+	} {
+		if _, ok := cache.Get(tt.digest); ok != tt.want {
+			t.Errorf("got %s token cached %v, want %v", name, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package tokenutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/biscuit-auth/biscuit-go/v2/datalog"
+	"github.com/biscuit-auth/biscuit-go/v2/parser"
+)
+
+// AudiencePredicate is the name of the facts injected for each audience
+// a token is evaluated for. Tokens restrict the audiences they are valid
+// for with checks on it, e.g. check if k8s:audience("kubernetes").
+const AudiencePredicate = "k8s:audience"
+
+// AudienceFacts returns the k8s:audience facts injected when evaluating
+// a token for the audiences.
+func AudienceFacts(audiences []string) []biscuit.Fact {
+	facts := []biscuit.Fact{}
+	for _, audience := range audiences {
+		facts = append(facts, biscuit.Fact{
+			Predicate: biscuit.Predicate{
+				Name: AudiencePredicate,
+				IDs:  []biscuit.Term{biscuit.String(audience)},
+			},
+		})
+	}
+
+	return facts
+}
+
+// CheckAudiences returns the audiences, out of the requested ones, for
+// which every check of the token that depends only on k8s:audience facts
+// passes, and an error if there are none. A token without audience
+// checks is valid for any audience, so all of the requested audiences
+// are returned.
+func CheckAudiences(b *biscuit.Biscuit, audiences []string) ([]string, error) {
+	symbols, err := symbolTable(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// The predicate is only in the symbol table of tokens mentioning it.
+	audienceSymbol, ok := symbols.Sym(AudiencePredicate).(datalog.String)
+	if !ok {
+		return audiences, nil
+	}
+
+	audienceChecks := []datalog.Check{}
+	for _, checks := range b.Checks() {
+		for _, check := range checks {
+			if onlyDependsOn(check, audienceSymbol) {
+				audienceChecks = append(audienceChecks, check)
+			}
+		}
+	}
+
+	if len(audienceChecks) == 0 {
+		return audiences, nil
+	}
+
+	accepted := []string{}
+	for _, audience := range audiences {
+		world := datalog.NewWorld()
+		world.AddFact(datalog.Fact{
+			Predicate: datalog.Predicate{
+				Name:  audienceSymbol,
+				Terms: []datalog.Term{symbols.Insert(audience)},
+			},
+		})
+
+		if passesAll(world, symbols, audienceChecks) {
+			accepted = append(accepted, audience)
+		}
+	}
+
+	if len(audiences) == 0 {
+		return nil, fmt.Errorf("token is restricted to audiences, but none were requested")
+	}
+
+	if len(accepted) == 0 {
+		return nil, fmt.Errorf("token is not valid for any of the audiences %q", audiences)
+	}
+
+	return accepted, nil
+}
+
+// passesAll reports whether every check has a query matching the world.
+func passesAll(world *datalog.World, symbols *datalog.SymbolTable, checks []datalog.Check) bool {
+	for _, check := range checks {
+		successful := false
+		for _, query := range check.Queries {
+			if len(*world.QueryRule(query, symbols)) != 0 {
+				successful = true
+				break
+			}
+		}
+
+		if !successful {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AudienceCheck returns a check restricting a token to the audiences.
+func AudienceCheck(audiences []string) (biscuit.Check, error) {
+	if len(audiences) == 0 {
+		return biscuit.Check{}, fmt.Errorf("at least one audience is required")
+	}
+
+	queries := make([]string, 0, len(audiences))
+	for _, audience := range audiences {
+		queries = append(queries, fmt.Sprintf("%s(%q)", AudiencePredicate, audience))
+	}
+
+	return parser.FromStringCheck("check if " + strings.Join(queries, " or "))
+}
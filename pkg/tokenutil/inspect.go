@@ -0,0 +1,177 @@
+package tokenutil
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/biscuit-auth/biscuit-go/v2/datalog"
+	"github.com/biscuit-auth/biscuit-go/v2/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// Block is the Datalog content of a token block, printed as source.
+type Block struct {
+	Facts        []string `json:"facts"`
+	Rules        []string `json:"rules"`
+	Checks       []string `json:"checks"`
+	Context      string   `json:"context,omitempty"`
+	RevocationID string   `json:"revocationID"`
+}
+
+// Blocks returns the contents of the token's blocks, starting with the
+// authority block. The signatures are not verified.
+//
+// biscuit-go only exposes the checks of a block, so the facts and rules
+// are read by unmarshalling a copy of the token in which they are
+// appended to the checks of their block, as queries whose head is the
+// fact or rule head. This relies on biscuit-go keeping the order of the
+// checks it unmarshals, so the number of checks read back is compared
+// with the block's contents and a mismatch is an error rather than a
+// mislabelled block.
+func Blocks(b *biscuit.Biscuit) ([]Block, error) {
+	serialized, err := b.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("serializing token: %w", err)
+	}
+
+	container := &pb.Biscuit{}
+	if err := proto.Unmarshal(serialized, container); err != nil {
+		return nil, fmt.Errorf("unmarshalling token container: %w", err)
+	}
+
+	signedBlocks := append([]*pb.SignedBlock{container.Authority}, container.Blocks...)
+	pbBlocks := make([]*pb.Block, len(signedBlocks))
+
+	for i, signed := range signedBlocks {
+		block := &pb.Block{}
+		if err := proto.Unmarshal(signed.Block, block); err != nil {
+			return nil, fmt.Errorf("unmarshalling token block: %w", err)
+		}
+		pbBlocks[i] = block
+
+		flattened := proto.Clone(block).(*pb.Block)
+		for _, rule := range block.RulesV2 {
+			flattened.ChecksV2 = append(flattened.ChecksV2, &pb.CheckV2{Queries: []*pb.RuleV2{rule}})
+		}
+		for _, fact := range block.FactsV2 {
+			flattened.ChecksV2 = append(flattened.ChecksV2, &pb.CheckV2{Queries: []*pb.RuleV2{{Head: fact.Predicate}}})
+		}
+		flattened.RulesV2, flattened.FactsV2 = nil, nil
+
+		flattenedBytes, err := proto.Marshal(flattened)
+		if err != nil {
+			return nil, fmt.Errorf("marshalling token block: %w", err)
+		}
+
+		signedBlocks[i] = &pb.SignedBlock{
+			Block:     flattenedBytes,
+			NextKey:   signed.NextKey,
+			Signature: signed.Signature,
+		}
+	}
+
+	flattenedContainer := &pb.Biscuit{
+		Authority: signedBlocks[0],
+		Blocks:    signedBlocks[1:],
+		Proof:     container.Proof,
+	}
+
+	flattenedBytes, err := proto.Marshal(flattenedContainer)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling token: %w", err)
+	}
+
+	flattenedToken, err := biscuit.Unmarshal(flattenedBytes)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling token: %w", err)
+	}
+
+	symbols, err := symbolTable(b)
+	if err != nil {
+		return nil, err
+	}
+	debug := datalog.SymbolDebugger{SymbolTable: symbols}
+	resolve := func(source string) string {
+		return resolveSetStrings(source, symbols)
+	}
+
+	revocationIDs := b.RevocationIds()
+	blocks := make([]Block, len(pbBlocks))
+
+	for i, checks := range flattenedToken.Checks() {
+		pbBlock := pbBlocks[i]
+		block := Block{
+			Facts:        []string{},
+			Rules:        []string{},
+			Checks:       []string{},
+			Context:      pbBlock.GetContext(),
+			RevocationID: hex.EncodeToString(revocationIDs[i]),
+		}
+
+		numChecks, numRules := len(pbBlock.ChecksV2), len(pbBlock.RulesV2)
+		if len(checks) != numChecks+numRules+len(pbBlock.FactsV2) {
+			return nil, fmt.Errorf("reading block %d: read %d checks, rules and facts, expected %d", i, len(checks), numChecks+numRules+len(pbBlock.FactsV2))
+		}
+
+		for j, check := range checks {
+			switch {
+			case j < numChecks:
+				block.Checks = append(block.Checks, resolve(debug.Check(check)))
+			case j < numChecks+numRules:
+				block.Rules = append(block.Rules, resolve(debug.Rule(check.Queries[0])))
+			default:
+				block.Facts = append(block.Facts, resolve(debug.Predicate(check.Queries[0].Head)))
+			}
+		}
+
+		blocks[i] = block
+	}
+
+	return blocks, nil
+}
+
+// resolveSetStrings replaces the symbol IDs that biscuit-go prints, as
+// #<id>, for the strings in sets with the quoted strings themselves.
+// Quotes escaped with a backslash do not end a string.
+func resolveSetStrings(source string, symbols *datalog.SymbolTable) string {
+	var out strings.Builder
+	inString := false
+
+	for i := 0; i < len(source); i++ {
+		c := source[i]
+		if inString && c == '\\' && i+1 < len(source) {
+			out.WriteByte(c)
+			out.WriteByte(source[i+1])
+			i++
+			continue
+		}
+
+		if c == '"' {
+			inString = !inString
+		}
+
+		if inString || c != '#' {
+			out.WriteByte(c)
+			continue
+		}
+
+		end := i + 1
+		for end < len(source) && source[end] >= '0' && source[end] <= '9' {
+			end++
+		}
+
+		id, err := strconv.ParseUint(source[i+1:end], 10, 64)
+		if err != nil {
+			out.WriteByte(c)
+			continue
+		}
+
+		out.WriteString(strconv.Quote(symbols.Str(datalog.String(id))))
+		i = end - 1
+	}
+
+	return out.String()
+}
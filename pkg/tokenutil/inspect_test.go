@@ -0,0 +1,57 @@
+package tokenutil
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/biscuit-auth/biscuit-go/v2/datalog"
+)
+
+func TestResolveSetStrings(t *testing.T) {
+	symbols := &datalog.SymbolTable{}
+	id := symbols.Insert("payments")
+
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "set string",
+			source: "team($t), [#" + idString(id) + "].contains($t)",
+			want:   `team($t), ["payments"].contains($t)`,
+		},
+		{
+			name:   "inside a string",
+			source: `note("#` + idString(id) + `")`,
+			want:   `note("#` + idString(id) + `")`,
+		},
+		{
+			name:   "after an escaped quote",
+			source: `note("say \"#` + idString(id) + `\"")`,
+			want:   `note("say \"#` + idString(id) + `\"")`,
+		},
+		{
+			name:   "after a string ending in an escaped backslash",
+			source: `note("\\"), [#` + idString(id) + `].contains($t)`,
+			want:   `note("\\"), ["payments"].contains($t)`,
+		},
+		{
+			name:   "not a symbol",
+			source: "# comment",
+			want:   "# comment",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveSetStrings(tt.source, symbols); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func idString(id datalog.String) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
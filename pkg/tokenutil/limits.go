@@ -0,0 +1,124 @@
+package tokenutil
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/biscuit-auth/biscuit-go/v2/datalog"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ErrLimitExceeded is wrapped by every error caused by a token exceeding
+// the configured Limits, so callers can report them distinctly.
+var ErrLimitExceeded = errors.New("token exceeds limits")
+
+// Limits bounds the resources spent on decoding and evaluating a token.
+// Zero values leave the corresponding limit unset, falling back to the
+// biscuit-go defaults for the Datalog limits.
+type Limits struct {
+	MaxTokenBytes     int
+	MaxBlocks         int
+	MaxFacts          int
+	MaxIterations     int
+	MaxEvaluationTime time.Duration
+}
+
+// Decode decodes and unmarshals the base64 encoded token, enforcing the
+// size and block count limits before the blocks are unmarshalled.
+func (l Limits) Decode(token string) (*biscuit.Biscuit, error) {
+	// DecodedLen counts padding as data, so it is subtracted to compare
+	// the exact decoded size.
+	if l.MaxTokenBytes > 0 && base64.URLEncoding.DecodedLen(len(token))-(len(token)-len(strings.TrimRight(token, "="))) > l.MaxTokenBytes {
+		return nil, fmt.Errorf("%w: token is larger than %d bytes", ErrLimitExceeded, l.MaxTokenBytes)
+	}
+
+	decodedToken, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("decoding token: %w", err)
+	}
+
+	if l.MaxBlocks > 0 {
+		blocks, err := countBlocks(decodedToken)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalling token: %w", err)
+		}
+
+		if blocks > l.MaxBlocks {
+			return nil, fmt.Errorf("%w: token has %d blocks, more than %d", ErrLimitExceeded, blocks, l.MaxBlocks)
+		}
+	}
+
+	biscToken, err := biscuit.Unmarshal(decodedToken)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling token: %w", err)
+	}
+
+	return biscToken, nil
+}
+
+// AuthorizerOptions returns the options applying the Datalog limits to
+// a biscuit.Authorizer.
+func (l Limits) AuthorizerOptions() []biscuit.AuthorizerOption {
+	worldOpts := []datalog.WorldOption{}
+
+	if l.MaxFacts > 0 {
+		worldOpts = append(worldOpts, datalog.WithMaxFacts(l.MaxFacts))
+	}
+
+	if l.MaxIterations > 0 {
+		worldOpts = append(worldOpts, datalog.WithMaxIterations(l.MaxIterations))
+	}
+
+	if l.MaxEvaluationTime > 0 {
+		worldOpts = append(worldOpts, datalog.WithMaxDuration(l.MaxEvaluationTime))
+	}
+
+	return []biscuit.AuthorizerOption{biscuit.WithWorldOptions(worldOpts...)}
+}
+
+// WrapLimitError wraps err with ErrLimitExceeded if it was caused by a
+// Datalog runtime limit, returning it unchanged otherwise.
+func WrapLimitError(err error) error {
+	if errors.Is(err, datalog.ErrWorldRunLimitMaxFacts) ||
+		errors.Is(err, datalog.ErrWorldRunLimitMaxIterations) ||
+		errors.Is(err, datalog.ErrWorldRunLimitTimeout) {
+		return fmt.Errorf("%w: %w", ErrLimitExceeded, err)
+	}
+
+	return err
+}
+
+// countBlocks counts the blocks of a serialized token, including the
+// authority block, by walking the top level protobuf fields without
+// unmarshalling the blocks themselves.
+func countBlocks(serialized []byte) (int, error) {
+	const (
+		authorityField protowire.Number = 2
+		blocksField    protowire.Number = 3
+	)
+
+	count := 0
+	for len(serialized) > 0 {
+		num, typ, n := protowire.ConsumeTag(serialized)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		serialized = serialized[n:]
+
+		if num == authorityField || num == blocksField {
+			count++
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, serialized)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		serialized = serialized[n:]
+	}
+
+	return count, nil
+}
@@ -0,0 +1,120 @@
+package tokenutil
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+)
+
+// newTestToken returns a serialized token with the given number of
+// blocks, including the authority block.
+func newTestToken(t *testing.T, blocks int) []byte {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	token, err := biscuit.NewBuilder(private).Build()
+	if err != nil {
+		t.Fatalf("building token: %v", err)
+	}
+
+	for i := 1; i < blocks; i++ {
+		token, err = token.Append(rand.Reader, token.CreateBlock().Build())
+		if err != nil {
+			t.Fatalf("appending block: %v", err)
+		}
+	}
+
+	serialized, err := token.Serialize()
+	if err != nil {
+		t.Fatalf("serializing token: %v", err)
+	}
+
+	return serialized
+}
+
+func TestCountBlocks(t *testing.T) {
+	for _, blocks := range []int{1, 2, 5} {
+		got, err := countBlocks(newTestToken(t, blocks))
+		if err != nil {
+			t.Fatalf("counting blocks: %v", err)
+		}
+
+		if got != blocks {
+			t.Errorf("got %d blocks, want %d", got, blocks)
+		}
+	}
+
+	if _, err := countBlocks([]byte{0xff}); err == nil {
+		t.Error("expected an error for a truncated token")
+	}
+}
+
+func TestLimitsDecode(t *testing.T) {
+	token := newTestToken(t, 3)
+	encoded := base64.URLEncoding.EncodeToString(token)
+
+	tests := []struct {
+		name      string
+		limits    Limits
+		token     string
+		wantLimit bool
+		wantErr   bool
+	}{
+		{
+			name:   "no limits",
+			token:  encoded,
+			limits: Limits{},
+		},
+		{
+			name:   "within limits",
+			token:  encoded,
+			limits: Limits{MaxTokenBytes: len(token), MaxBlocks: 3},
+		},
+		{
+			name:      "oversize",
+			token:     encoded,
+			limits:    Limits{MaxTokenBytes: len(token) - 1},
+			wantLimit: true,
+		},
+		{
+			name:      "too many blocks",
+			token:     encoded,
+			limits:    Limits{MaxBlocks: 2},
+			wantLimit: true,
+		},
+		{
+			name:    "not base64",
+			token:   "not a token!",
+			limits:  Limits{MaxBlocks: 2},
+			wantErr: true,
+		},
+		{
+			name:    "not a token",
+			token:   base64.URLEncoding.EncodeToString([]byte{0xff}),
+			limits:  Limits{MaxBlocks: 2},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.limits.Decode(tt.token)
+
+			if got := errors.Is(err, ErrLimitExceeded); got != tt.wantLimit {
+				t.Errorf("got limit error %v, want %v: %v", got, tt.wantLimit, err)
+			}
+
+			if got := err != nil; got != tt.wantErr && !tt.wantLimit {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
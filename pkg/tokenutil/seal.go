@@ -0,0 +1,23 @@
+package tokenutil
+
+import (
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/biscuit-auth/biscuit-go/v2/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// Sealed reports whether the token is sealed, i.e. ends with a final
+// signature rather than the secret key needed to append more blocks.
+func Sealed(b *biscuit.Biscuit) bool {
+	serialized, err := b.Serialize()
+	if err != nil {
+		return false
+	}
+
+	container := &pb.Biscuit{}
+	if err := proto.Unmarshal(serialized, container); err != nil {
+		return false
+	}
+
+	return container.GetProof().GetFinalSignature() != nil
+}
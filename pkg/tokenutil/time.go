@@ -0,0 +1,170 @@
+package tokenutil
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/biscuit-auth/biscuit-go/v2"
+	"github.com/biscuit-auth/biscuit-go/v2/datalog"
+	"github.com/biscuit-auth/biscuit-go/v2/parser"
+	"github.com/biscuit-auth/biscuit-go/v2/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// TimeFacts returns the ambient time facts injected when evaluating a
+// token. With a non-zero clock skew two facts are returned, one at
+// now-skew and one at now+skew, so that expiry checks
+// (time($t), $t <= ...) and not-before checks (time($t), $t >= ...)
+// each tolerate the configured skew.
+func TimeFacts(now time.Time, skew time.Duration) []biscuit.Fact {
+	facts := []biscuit.Fact{}
+	for _, t := range ambientTimes(now, skew) {
+		facts = append(facts, biscuit.Fact{
+			Predicate: biscuit.Predicate{
+				Name: "time",
+				IDs:  []biscuit.Term{biscuit.Date(t)},
+			},
+		})
+	}
+
+	return facts
+}
+
+func ambientTimes(now time.Time, skew time.Duration) []time.Time {
+	times := []time.Time{now.Add(-skew).UTC().Truncate(time.Second)}
+	if skew != 0 {
+		times = append(times, now.Add(skew).UTC().Truncate(time.Second))
+	}
+	return times
+}
+
+// ExpiryCheck returns a check that fails once the given time has passed.
+func ExpiryCheck(expiresAt time.Time) (biscuit.Check, error) {
+	return parser.FromStringCheck(fmt.Sprintf("check if time($time), $time <= %s", expiresAt.UTC().Format(time.RFC3339)))
+}
+
+// NotBeforeCheck returns a check that fails until the given time.
+func NotBeforeCheck(notBefore time.Time) (biscuit.Check, error) {
+	return parser.FromStringCheck(fmt.Sprintf("check if time($time), $time >= %s", notBefore.UTC().Format(time.RFC3339)))
+}
+
+// ValidityChecks returns the checks bounding a token's lifetime to the
+// given times. A zero time leaves that side unbounded.
+func ValidityChecks(expiresAt, notBefore time.Time) ([]biscuit.Check, error) {
+	checks := []biscuit.Check{}
+
+	if !expiresAt.IsZero() {
+		check, err := ExpiryCheck(expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse expiry check: %v", err)
+		}
+
+		checks = append(checks, check)
+	}
+
+	if !notBefore.IsZero() {
+		if !expiresAt.IsZero() && !notBefore.Before(expiresAt) {
+			return nil, errors.New("not-before must be before the token expiry")
+		}
+
+		check, err := NotBeforeCheck(notBefore)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse not-before check: %v", err)
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks, nil
+}
+
+// CheckTime evaluates the checks of every block that depend only on
+// time facts, returning an error describing the first one that fails.
+// Checks that also depend on other facts, such as request attributes,
+// are skipped as they can only be evaluated during authorization.
+func CheckTime(b *biscuit.Biscuit, now time.Time, skew time.Duration) error {
+	symbols, err := symbolTable(b)
+	if err != nil {
+		return err
+	}
+
+	// time is one of the default symbols, so it always has an index.
+	timeSymbol := symbols.Sym("time").(datalog.String)
+
+	world := datalog.NewWorld()
+	for _, t := range ambientTimes(now, skew) {
+		world.AddFact(datalog.Fact{
+			Predicate: datalog.Predicate{
+				Name:  timeSymbol,
+				Terms: []datalog.Term{datalog.Date(t.Unix())},
+			},
+		})
+	}
+
+	debug := datalog.SymbolDebugger{SymbolTable: symbols}
+	for i, checks := range b.Checks() {
+		for j, check := range checks {
+			if !onlyDependsOn(check, timeSymbol) {
+				continue
+			}
+
+			successful := false
+			for _, query := range check.Queries {
+				if len(*world.QueryRule(query, symbols)) != 0 {
+					successful = true
+					break
+				}
+			}
+
+			if !successful {
+				return fmt.Errorf("failed to verify block #%d check #%d: %s", i, j, debug.Check(check))
+			}
+		}
+	}
+
+	return nil
+}
+
+// symbolTable rebuilds the symbol table of the token, which biscuit-go
+// does not expose, from the symbols carried by each of its blocks.
+func symbolTable(b *biscuit.Biscuit) (*datalog.SymbolTable, error) {
+	serialized, err := b.Serialize()
+	if err != nil {
+		return nil, fmt.Errorf("serializing token: %w", err)
+	}
+
+	container := &pb.Biscuit{}
+	if err := proto.Unmarshal(serialized, container); err != nil {
+		return nil, fmt.Errorf("unmarshalling token container: %w", err)
+	}
+
+	symbols := &datalog.SymbolTable{}
+	for _, signed := range append([]*pb.SignedBlock{container.Authority}, container.Blocks...) {
+		block := &pb.Block{}
+		if err := proto.Unmarshal(signed.Block, block); err != nil {
+			return nil, fmt.Errorf("unmarshalling token block: %w", err)
+		}
+
+		blockSymbols := datalog.SymbolTable(block.Symbols)
+		symbols.Extend(&blockSymbols)
+	}
+
+	return symbols, nil
+}
+
+func onlyDependsOn(check datalog.Check, name datalog.String) bool {
+	for _, query := range check.Queries {
+		if len(query.Body) == 0 {
+			return false
+		}
+
+		for _, predicate := range query.Body {
+			if predicate.Name != name {
+				return false
+			}
+		}
+	}
+
+	return true
+}